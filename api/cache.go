@@ -0,0 +1,91 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// PackageCacheDir returns the directory of the package cache.
+func PackageCacheDir() string {
+	return filepath.Join(filesystem.GetDefaultPath(), filesystem.DefaultCacheDir, PackagesCacheDir)
+}
+
+// bepInExPackPrefix starts the file names of the cached BepInExPack versions. Profiles
+// reinstall their BepInEx from them, so they are kept outside the cache size limit.
+const bepInExPackPrefix = "BepInEx-BepInExPack-"
+
+// TrimPackageCache removes the least recently used packages until the package cache
+// fits in maxBytes. The keep paths and the BepInExPack packages are never removed and
+// don't count towards maxBytes. It returns the removed paths.
+func TrimPackageCache(maxBytes int64, keep ...string) ([]string, error) {
+	entries, err := os.ReadDir(PackageCacheDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	kept := map[string]bool{}
+	for _, path := range keep {
+		kept[path] = true
+	}
+
+	type cachedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || filepath.Ext(entry.Name()) != ".zip" || strings.HasPrefix(entry.Name(), bepInExPackPrefix) {
+			continue
+		}
+		total += info.Size()
+		files = append(files, cachedFile{filepath.Join(PackageCacheDir(), entry.Name()), info.Size(), info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	var removed []string
+	for _, file := range files {
+		if total <= maxBytes {
+			break
+		}
+		if kept[file.path] {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil {
+			return removed, err
+		}
+		total -= file.size
+		removed = append(removed, file.path)
+	}
+
+	return removed, nil
+}
+
+// trimPackageCacheToConfig applies the cache size limit of the active config, keeping
+// the packages that were just used. They are marked as used first, so the cache drops
+// the packages that weren't needed for the longest time.
+func trimPackageCacheToConfig(used ...string) error {
+	now := time.Now()
+	for _, path := range used {
+		os.Chtimes(path, now, now)
+	}
+
+	limit := config.Active().CacheSizeMB
+	if limit <= 0 {
+		return nil
+	}
+
+	_, err := TrimPackageCache(limit*1024*1024, used...)
+	return err
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// setupCache points the default path at a temporary directory and writes the
+// packages, oldest first, into the package cache.
+func setupCache(t *testing.T, packages ...string) {
+	t.Helper()
+	basePath := t.TempDir()
+	getDefaultPath := filesystem.GetDefaultPath
+	filesystem.GetDefaultPath = func() string { return basePath }
+	t.Cleanup(func() { filesystem.GetDefaultPath = getDefaultPath })
+
+	if err := os.MkdirAll(PackageCacheDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-time.Hour)
+	for _, pkg := range packages {
+		path := filepath.Join(PackageCacheDir(), pkg+".zip")
+		if err := os.WriteFile(path, make([]byte, 1024), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		modTime = modTime.Add(time.Minute)
+	}
+}
+
+func TestTrimPackageCacheKeepsBepInExPack(t *testing.T) {
+	setupCache(t, "BepInEx-BepInExPack-5.4.2100", "x753-A-1.0.0", "x753-B-1.0.0", "BepInEx-BepInExPack-5.4.2101", "x753-C-1.0.0")
+
+	removed, err := TrimPackageCache(2048, filepath.Join(PackageCacheDir(), "x753-A-1.0.0.zip"))
+	if err != nil {
+		t.Fatalf("TrimPackageCache() failed: %v", err)
+	}
+	want := []string{filepath.Join(PackageCacheDir(), "x753-B-1.0.0.zip")}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("TrimPackageCache() removed %v, want %v", removed, want)
+	}
+
+	removed, err = TrimPackageCache(0)
+	if err != nil {
+		t.Fatalf("TrimPackageCache() failed: %v", err)
+	}
+	want = []string{filepath.Join(PackageCacheDir(), "x753-A-1.0.0.zip"), filepath.Join(PackageCacheDir(), "x753-C-1.0.0.zip")}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("TrimPackageCache(0) removed %v, want %v", removed, want)
+	}
+}
+
+func TestCachedModDetails(t *testing.T) {
+	setupCache(t, "x753-Mimics-1.0.0", "x753-Mimics-1.5.0", "x753-Mimics-Extra-9.0.0")
+
+	details, err := cachedModDetails("x753", "Mimics")
+	if err != nil {
+		t.Fatalf("cachedModDetails() failed: %v", err)
+	}
+	if *details != (ModDetailsResponse{LatestVersion: "1.5.0"}) {
+		t.Errorf("cachedModDetails() without an index = %+v, want the newest cached version", *details)
+	}
+
+	// The index knows a newer version, which isn't cached and can't be installed offline.
+	index, err := json.Marshal([]IndexPackage{{
+		FullName:    "x753-Mimics",
+		RatingScore: 42,
+		Versions: []IndexVersion{
+			{VersionNumber: "2.0.0", Downloads: 10},
+			{VersionNumber: "1.5.0", Downloads: 5},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(PackageIndexPath(), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err = cachedModDetails("x753", "Mimics")
+	if err != nil {
+		t.Fatalf("cachedModDetails() failed: %v", err)
+	}
+	if want := (ModDetailsResponse{Downloads: 15, RatingScore: 42, LatestVersion: "1.5.0"}); *details != want {
+		t.Errorf("cachedModDetails() = %+v, want %+v", *details, want)
+	}
+
+	if _, err := cachedModDetails("x753", "Missing"); err == nil {
+		t.Error("cachedModDetails() of a package without cached versions succeeded")
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+)
+
+// HTTPClient makes all requests to the external services. It goes through the proxy
+// in the active config, or the proxy environment variables when none is set.
+var HTTPClient = &http.Client{Transport: newTransport()}
+
+func newTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = configProxy
+	return transport
+}
+
+// configProxy returns the proxy for a request, read from the active config on every
+// request so a changed proxy applies without restarting.
+func configProxy(req *http.Request) (*url.URL, error) {
+	proxy := config.Active().Proxy
+	if proxy == "" {
+		return http.ProxyFromEnvironment(req)
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	return proxyURL, nil
+}
+
+// communityURL returns the Thunderstore URL of the active community with the given path.
+func communityURL(path string) string {
+	return fmt.Sprintf("https://thunderstore.io/c/%s/%s", config.Active().Community, path)
+}
@@ -0,0 +1,394 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+)
+
+// partSuffix is appended to a file while it is being downloaded. Partial files
+// are resumed with a Range request the next time the same file is downloaded.
+const partSuffix = ".part"
+
+// retryBackoff is how long the first retry of a failed request waits, every further
+// retry waits one more retryBackoff.
+var retryBackoff = 2 * time.Second
+
+// errRequestFailed is returned when a download request got no response at all.
+var errRequestFailed = errors.New("error making download request")
+
+// DownloadRequest is a file to download to Path.
+type DownloadRequest struct {
+	URL      string
+	Path     string
+	Expected ExpectedFile
+}
+
+// DownloadResult is the outcome of a DownloadRequest.
+type DownloadResult struct {
+	Request DownloadRequest
+	Err     error
+}
+
+// Downloader runs a bounded number of downloads in parallel. All of its downloads
+// share one rate limiter, and concurrent downloads to the same path are only fetched once.
+type Downloader struct {
+	// MaxRetries is how often a rate limited, interrupted or failed download is retried.
+	MaxRetries int
+	Client     *http.Client
+	// Settings, when set, is asked for the concurrency and retry count before every
+	// download, so they can follow settings that change while the downloader is in use.
+	Settings func() (concurrency, retries int)
+
+	slots   chan struct{}
+	limiter *RateLimiter
+
+	mu       sync.Mutex
+	inFlight map[string]*downloadCall
+}
+
+type downloadCall struct {
+	done chan struct{}
+	err  error
+}
+
+// DefaultDownloader is used by the package download functions. Its concurrency and
+// retries come from the active config.
+var DefaultDownloader = newConfigDownloader()
+
+func newConfigDownloader() *Downloader {
+	d := NewDownloader(config.DefaultConfig().DownloadConcurrency)
+	d.Client = HTTPClient
+	d.Settings = func() (int, int) {
+		settings := config.Active()
+		return settings.DownloadConcurrency, settings.DownloadRetries
+	}
+	return d
+}
+
+// NewDownloader creates a downloader that runs at most concurrency downloads at once.
+func NewDownloader(concurrency int) *Downloader {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Downloader{
+		MaxRetries: 5,
+		Client:     http.DefaultClient,
+		slots:      make(chan struct{}, concurrency),
+		limiter:    NewRateLimiter(100 * time.Millisecond),
+		inFlight:   map[string]*downloadCall{},
+	}
+}
+
+// Download downloads the file of the request and verifies it. An existing valid file
+// at the path is not downloaded again. A download that fails verification is fetched
+// once more from scratch before its *IntegrityError is returned.
+func (d *Downloader) Download(ctx context.Context, req DownloadRequest) error {
+	d.mu.Lock()
+	if call, ok := d.inFlight[req.Path]; ok {
+		d.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &downloadCall{done: make(chan struct{})}
+	d.inFlight[req.Path] = call
+	d.mu.Unlock()
+
+	call.err = d.download(ctx, req)
+
+	d.mu.Lock()
+	delete(d.inFlight, req.Path)
+	d.mu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// DownloadAll downloads all requests in parallel, bounded by the downloader's concurrency.
+// The results are in the order of the requests.
+func (d *Downloader) DownloadAll(ctx context.Context, reqs []DownloadRequest) []DownloadResult {
+	results := make([]DownloadResult, len(reqs))
+
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req DownloadRequest) {
+			defer wg.Done()
+			results[i] = DownloadResult{Request: req, Err: d.Download(ctx, req)}
+		}(i, req)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (d *Downloader) download(ctx context.Context, req DownloadRequest) error {
+	name := filepath.Base(req.Path)
+	if _, err := os.Stat(req.Path); err == nil {
+		if VerifyDownload(req.Path, name, req.Expected) == nil {
+			return nil
+		}
+		os.Remove(req.Path)
+	}
+
+	if IsOffline() {
+		return fmt.Errorf("%s: %w", name, ErrNotCached)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(req.Path), 0755); err != nil {
+		return err
+	}
+
+	slots, retries := d.limits()
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var err error
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err = d.fetchWithRetries(ctx, req.URL, req.Path+partSuffix, retries); err != nil {
+			return err
+		}
+		if err = os.Rename(req.Path+partSuffix, req.Path); err != nil {
+			return err
+		}
+
+		err = VerifyDownload(req.Path, name, req.Expected)
+		if err == nil {
+			return nil
+		}
+		os.Remove(req.Path)
+
+		var integrityErr *IntegrityError
+		if !errors.As(err, &integrityErr) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// limits returns the download slots and the retry count for the next download.
+// When Settings asks for a different concurrency the slots are replaced; downloads
+// that hold a slot of the old ones release it there.
+func (d *Downloader) limits() (chan struct{}, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	retries := d.MaxRetries
+	if d.Settings != nil {
+		var concurrency int
+		concurrency, retries = d.Settings()
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		if concurrency != cap(d.slots) {
+			d.slots = make(chan struct{}, concurrency)
+		}
+	}
+
+	return d.slots, retries
+}
+
+// fetchWithRetries downloads the URL into partPath, retrying when rate limited, when
+// the request fails or when the transfer is interrupted. Interrupted transfers continue
+// where they stopped. Only when the server still can't be connected to after the last
+// attempt are further requests served offline for a while.
+func (d *Downloader) fetchWithRetries(ctx context.Context, downloadURL, partPath string, retries int) error {
+	var err error
+	for attempt := 1; attempt <= retries; attempt++ {
+		if err = d.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		var retryAfter time.Duration
+		retryAfter, err = d.fetch(ctx, downloadURL, partPath)
+		if err == nil {
+			return nil
+		}
+
+		var integrityErr *IntegrityError
+		switch {
+		case errors.Is(err, errTooManyRequests):
+			if retryAfter <= 0 {
+				retryAfter = time.Duration(attempt) * retryBackoff
+			}
+			d.limiter.Pause(retryAfter)
+		case errors.As(err, &integrityErr):
+			// The connection dropped, the next attempt resumes the partial file.
+		case errors.Is(err, errRequestFailed) && ctx.Err() == nil:
+			if attempt == retries {
+				break
+			}
+			if err := sleep(ctx, time.Duration(attempt)*retryBackoff); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+
+	markUnreachable(err)
+	return fmt.Errorf("failed to download %s after %d attempts: %w", downloadURL, retries, err)
+}
+
+// fetch performs a single request, resuming partPath if it already has data.
+// For rate limited responses it returns how long the server asked to wait.
+func (d *Downloader) fetch(ctx context.Context, url, partPath string) (time.Duration, error) {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errRequestFailed, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server ignored the range, start over.
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		// Appending anything but the requested range would corrupt the file, start over.
+		if start, ok := parseContentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			err := fmt.Errorf("unexpected content range %q, requested bytes from %d", resp.Header.Get("Content-Range"), offset)
+			return 0, &IntegrityError{Name: filepath.Base(partPath), Kind: IntegrityIncomplete, Err: errors.Join(os.Remove(partPath), err)}
+		}
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is no longer usable, e.g. the file changed on the server.
+		return 0, &IntegrityError{Name: filepath.Base(partPath), Kind: IntegrityIncomplete, Err: errors.Join(os.Remove(partPath), errors.New(resp.Status))}
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return parseRetryAfter(resp.Header.Get("Retry-After")), errTooManyRequests
+	default:
+		return 0, fmt.Errorf("received non-OK response status: %s", resp.Status)
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return 0, &IntegrityError{Name: filepath.Base(partPath), Kind: IntegrityIncomplete, Err: err}
+	}
+
+	return 0, nil
+}
+
+// parseContentRangeStart reads the first byte position of a Content-Range header
+// like "bytes 100-199/200".
+func parseContentRangeStart(value string) (int64, bool) {
+	rangeSpec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(rangeSpec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, which holds either seconds or a date.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// RateLimiter spaces out requests and pauses all of them when a server asks to back off.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter creates a limiter that allows one request per interval.
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval}
+}
+
+// Wait blocks until the next request may be made.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause holds back all requests for the duration, e.g. from a Retry-After header.
+func (l *RateLimiter) Pause(duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(duration); until.After(l.next) {
+		l.next = until
+	}
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPackage returns a small valid package archive.
+func testPackage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(`{"name": "Mimics", "version_number": "2.3.0", "description": "` + strings.Repeat("x", 4096) + `"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestDownloader(server *httptest.Server) *Downloader {
+	d := NewDownloader(4)
+	d.Client = server.Client()
+	d.MaxRetries = 3
+	return d
+}
+
+func withRetryBackoff(t *testing.T, backoff time.Duration) {
+	t.Helper()
+	old := retryBackoff
+	retryBackoff = backoff
+	t.Cleanup(func() { retryBackoff = old })
+}
+
+func checkDownloaded(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("downloaded %d bytes, want %d bytes", len(got), len(want))
+	}
+	if _, err := os.Stat(path + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial file still exists: %v", err)
+	}
+}
+
+func TestDownloadResumesPartialFile(t *testing.T) {
+	content := testPackage(t)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "package.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "package.zip")
+	if err := os.WriteFile(path+partSuffix, content[:100], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestDownloader(server).Download(context.Background(), DownloadRequest{URL: server.URL, Path: path}); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	checkDownloaded(t, path, content)
+	if len(ranges) != 1 || ranges[0] != "bytes=100-" {
+		t.Errorf("requested ranges %q, want [bytes=100-]", ranges)
+	}
+}
+
+func TestDownloadRestartsOnUnexpectedContentRange(t *testing.T) {
+	content := testPackage(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Answer with the start of the file instead of the requested range.
+			w.Header().Set("Content-Range", "bytes 0-99/"+strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[:100])
+			return
+		}
+		http.ServeContent(w, r, "package.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "package.zip")
+	if err := os.WriteFile(path+partSuffix, content[:100], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestDownloader(server).Download(context.Background(), DownloadRequest{URL: server.URL, Path: path}); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	checkDownloaded(t, path, content)
+	if got := requests.Load(); got != 2 {
+		t.Errorf("made %d requests, want 2", got)
+	}
+}
+
+func TestDownloadWaitsForRetryAfter(t *testing.T) {
+	content := testPackage(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "package.zip")
+	start := time.Now()
+	if err := newTestDownloader(server).Download(context.Background(), DownloadRequest{URL: server.URL, Path: path}); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	checkDownloaded(t, path, content)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the 1s of Retry-After", elapsed)
+	}
+}
+
+func TestDownloadRetriesFailedRequests(t *testing.T) {
+	withRetryBackoff(t, 10*time.Millisecond)
+	content := testPackage(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Drop the connection without a response.
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "package.zip")
+	if err := newTestDownloader(server).Download(context.Background(), DownloadRequest{URL: server.URL, Path: path}); err != nil {
+		t.Fatalf("Download() failed: %v", err)
+	}
+	checkDownloaded(t, path, content)
+	if IsOffline() {
+		t.Error("a dropped connection switched to offline mode")
+	}
+}
+
+func TestDownloadDeduplicatesConcurrentDownloads(t *testing.T) {
+	content := testPackage(t)
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	d := newTestDownloader(server)
+	path := filepath.Join(t.TempDir(), "package.zip")
+	errs := make([]error, 5)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = d.Download(context.Background(), DownloadRequest{URL: server.URL, Path: path})
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Download() failed: %v", err)
+		}
+	}
+	checkDownloaded(t, path, content)
+	if got := requests.Load(); got != 1 {
+		t.Errorf("made %d requests, want 1", got)
+	}
+}
+
+func TestMarkUnreachable(t *testing.T) {
+	defer SetOffline(false)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = http.Get("http://" + addr)
+	if err == nil {
+		t.Fatal("request to a closed port succeeded")
+	}
+	if !markUnreachable(err) || !IsOffline() {
+		t.Errorf("markUnreachable(%v) didn't switch to offline mode", err)
+	}
+	SetOffline(false)
+
+	if markUnreachable(context.Canceled) || markUnreachable(errRequestFailed) {
+		t.Error("markUnreachable() switched to offline mode for an error that isn't a connection failure")
+	}
+}
+
+func TestParseContentRangeStart(t *testing.T) {
+	tests := []struct {
+		value string
+		start int64
+		ok    bool
+	}{
+		{"bytes 100-199/200", 100, true},
+		{"bytes 0-99/*", 0, true},
+		{"bytes */200", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		start, ok := parseContentRangeStart(test.value)
+		if start != test.start || ok != test.ok {
+			t.Errorf("parseContentRangeStart(%q) = %d, %v, want %d, %v", test.value, start, ok, test.start, test.ok)
+		}
+	}
+}
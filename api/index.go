@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// PackageIndexFileName is the cached Thunderstore package list inside the cache dir.
+// Communities other than the default one get their own index-<community>.json.
+const PackageIndexFileName = "index.json"
+
+// IndexPackage is a package in the Thunderstore package list.
+type IndexPackage struct {
+	Name         string         `json:"name"`
+	FullName     string         `json:"full_name"`
+	Owner        string         `json:"owner"`
+	PackageURL   string         `json:"package_url"`
+	DateCreated  time.Time      `json:"date_created"`
+	DateUpdated  time.Time      `json:"date_updated"`
+	RatingScore  int            `json:"rating_score"`
+	IsDeprecated bool           `json:"is_deprecated"`
+	Categories   []string       `json:"categories"`
+	Versions     []IndexVersion `json:"versions"`
+}
+
+// IndexVersion is a version of a package in the Thunderstore package list.
+type IndexVersion struct {
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	Icon          string    `json:"icon"`
+	VersionNumber string    `json:"version_number"`
+	Dependencies  []string  `json:"dependencies"`
+	DownloadURL   string    `json:"download_url"`
+	Downloads     int       `json:"downloads"`
+	DateCreated   time.Time `json:"date_created"`
+	FileSize      int64     `json:"file_size"`
+}
+
+// Latest returns the newest version of the package. Thunderstore lists versions newest first.
+func (p *IndexPackage) Latest() *IndexVersion {
+	if len(p.Versions) == 0 {
+		return nil
+	}
+	return &p.Versions[0]
+}
+
+// Version returns the version of the package with the given version number.
+func (p *IndexPackage) Version(versionNumber string) *IndexVersion {
+	for i := range p.Versions {
+		if p.Versions[i].VersionNumber == versionNumber {
+			return &p.Versions[i]
+		}
+	}
+	return nil
+}
+
+// Downloads returns the downloads of all versions of the package.
+func (p *IndexPackage) Downloads() int {
+	var downloads int
+	for _, version := range p.Versions {
+		downloads += version.Downloads
+	}
+	return downloads
+}
+
+// loadedIndex keeps the parsed package index in memory until the file changes.
+var loadedIndex struct {
+	sync.Mutex
+	path     string
+	modTime  time.Time
+	packages map[string]*IndexPackage
+	list     []IndexPackage
+}
+
+// PackageIndexPath returns where the package index of the configured community is cached.
+func PackageIndexPath() string {
+	fileName := PackageIndexFileName
+	if community := config.Active().Community; community != config.DefaultConfig().Community {
+		fileName = fmt.Sprintf("index-%s.json", community)
+	}
+	return filepath.Join(filesystem.GetDefaultPath(), filesystem.DefaultCacheDir, fileName)
+}
+
+// UpdatePackageIndex downloads the current Thunderstore package list of the configured
+// community into the cache.
+func UpdatePackageIndex() error {
+	if IsOffline() {
+		return fmt.Errorf("package index: %w", ErrNotCached)
+	}
+
+	resp, err := HTTPClient.Get(communityURL("api/v1/package/"))
+	if err != nil {
+		markUnreachable(err)
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received non-OK response status: %s", resp.Status)
+	}
+
+	indexPath := PackageIndexPath()
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		return err
+	}
+
+	// Download next to the index first, so the cached index is never left incomplete.
+	tmpFile, err := os.Create(indexPath + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmpFile, resp.Body)
+	tmpFile.Close()
+	if err != nil {
+		os.Remove(indexPath + ".tmp")
+		return fmt.Errorf("error downloading package index: %w", err)
+	}
+
+	return os.Rename(indexPath+".tmp", indexPath)
+}
+
+// LoadPackageIndex returns the packages of the cached package index.
+func LoadPackageIndex() ([]IndexPackage, error) {
+	loadedIndex.Lock()
+	defer loadedIndex.Unlock()
+
+	if err := loadPackageIndex(); err != nil {
+		return nil, err
+	}
+	return loadedIndex.list, nil
+}
+
+// FindIndexPackage looks up a package in the cached package index.
+func FindIndexPackage(modAuthor, modName string) (*IndexPackage, error) {
+	loadedIndex.Lock()
+	defer loadedIndex.Unlock()
+
+	if err := loadPackageIndex(); err != nil {
+		return nil, err
+	}
+
+	pkg, ok := loadedIndex.packages[modAuthor+"-"+modName]
+	if !ok {
+		return nil, fmt.Errorf("package %s-%s: %w", modAuthor, modName, ErrNotCached)
+	}
+	return pkg, nil
+}
+
+// loadPackageIndex parses the cached index if it changed since it was last loaded.
+// The caller must hold the lock of loadedIndex.
+func loadPackageIndex() error {
+	indexPath := PackageIndexPath()
+	info, err := os.Stat(indexPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("package index: %w", ErrNotCached)
+	} else if err != nil {
+		return err
+	}
+
+	if loadedIndex.packages != nil && indexPath == loadedIndex.path && info.ModTime().Equal(loadedIndex.modTime) {
+		return nil
+	}
+
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var list []IndexPackage
+	if err := json.NewDecoder(file).Decode(&list); err != nil {
+		return fmt.Errorf("error decoding package index: %w", err)
+	}
+
+	packages := make(map[string]*IndexPackage, len(list))
+	for i := range list {
+		packages[list[i].FullName] = &list[i]
+	}
+
+	loadedIndex.path = indexPath
+	loadedIndex.modTime = info.ModTime()
+	loadedIndex.packages = packages
+	loadedIndex.list = list
+	return nil
+}
+
+// indexExpectedFile returns what the package index says about the package file.
+// Without a cached index nothing is expected.
+func indexExpectedFile(pkg PackageRef) ExpectedFile {
+	if _, err := os.Stat(PackageIndexPath()); err != nil {
+		return ExpectedFile{}
+	}
+
+	indexPackage, err := FindIndexPackage(pkg.Author, pkg.Name)
+	if err != nil {
+		return ExpectedFile{}
+	}
+	if version := indexPackage.Version(pkg.Version); version != nil {
+		return ExpectedFile{Size: version.FileSize}
+	}
+	return ExpectedFile{}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+)
+
+// ExpectedFile is what a download should look like according to the index it came from.
+// Zero values are not checked.
+type ExpectedFile struct {
+	Size   int64
+	SHA256 string
+}
+
+type IntegrityErrorKind string
+
+const (
+	IntegrityIncomplete   IntegrityErrorKind = "incomplete"
+	IntegritySizeMismatch IntegrityErrorKind = "size-mismatch"
+	IntegrityHashMismatch IntegrityErrorKind = "hash-mismatch"
+	IntegrityInvalidZip   IntegrityErrorKind = "invalid-zip"
+)
+
+// IntegrityError is returned when a download is incomplete, doesn't match what the index
+// says, or isn't a readable zip archive.
+type IntegrityError struct {
+	Name     string             `json:"name"`
+	Kind     IntegrityErrorKind `json:"kind"`
+	Expected string             `json:"expected,omitempty"`
+	Actual   string             `json:"actual,omitempty"`
+	Err      error              `json:"-"`
+}
+
+func (e *IntegrityError) Error() string {
+	switch e.Kind {
+	case IntegrityIncomplete:
+		return fmt.Sprintf("download of %s did not complete: %v", e.Name, e.Err)
+	case IntegritySizeMismatch:
+		return fmt.Sprintf("download of %s is %s bytes, expected %s", e.Name, e.Actual, e.Expected)
+	case IntegrityHashMismatch:
+		return fmt.Sprintf("sha256 of %s is %s, expected %s", e.Name, e.Actual, e.Expected)
+	default:
+		return fmt.Sprintf("%s is not a valid zip archive: %v", e.Name, e.Err)
+	}
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// ExpectedGitHubAsset returns what to expect from a GitHub release asset
+// with the given size and digest, e.g. "sha256:4f3c...".
+func ExpectedGitHubAsset(size int64, digest string) ExpectedFile {
+	expected := ExpectedFile{Size: size}
+	if hash, ok := strings.CutPrefix(digest, "sha256:"); ok {
+		expected.SHA256 = hash
+	}
+	return expected
+}
+
+// VerifyDownload checks the downloaded file against what is expected and makes sure it is
+// a zip archive all of whose files can be read. name is only used in the error.
+func VerifyDownload(path, name string, expected ExpectedFile) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if expected.Size > 0 && info.Size() != expected.Size {
+		return &IntegrityError{
+			Name: name, Kind: IntegritySizeMismatch,
+			Expected: strconv.FormatInt(expected.Size, 10), Actual: strconv.FormatInt(info.Size(), 10),
+		}
+	}
+
+	if expected.SHA256 != "" {
+		hash, err := fileutil.HashFile(path)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(hash, expected.SHA256) {
+			return &IntegrityError{Name: name, Kind: IntegrityHashMismatch, Expected: expected.SHA256, Actual: hash}
+		}
+	}
+
+	// Reading every file checks their CRC-32, which catches corrupted archives that
+	// would otherwise only half-extract.
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return &IntegrityError{Name: name, Kind: IntegrityInvalidZip, Err: err}
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err := readZipFile(f); err != nil {
+			return &IntegrityError{Name: name, Kind: IntegrityInvalidZip, Err: fmt.Errorf("%s: %w", f.Name, err)}
+		}
+	}
+
+	return nil
+}
+
+func readZipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// ErrNotCached is returned in offline mode for anything that is not in the
+// cached package index or the package cache.
+var ErrNotCached = errors.New("not cached, unavailable offline")
+
+// offlineRecheckInterval is how long Thunderstore is treated as unreachable
+// after a request failed to connect.
+const offlineRecheckInterval = time.Minute
+
+// offlinePageSize is how many mods a page of offline search results has.
+const offlinePageSize = 20
+
+var offlineMode atomic.Bool
+var unreachableSince atomic.Int64
+
+// SetOffline turns offline mode on or off. In offline mode version lookups, search and
+// downloads are served only from the cached package index and the package cache.
+func SetOffline(offline bool) {
+	offlineMode.Store(offline)
+	if !offline {
+		unreachableSince.Store(0)
+	}
+}
+
+// IsOffline reports whether offline mode is on, either because it was set, because
+// the active config has it on, or because a recent request couldn't reach the server.
+func IsOffline() bool {
+	if offlineMode.Load() || config.Active().Offline {
+		return true
+	}
+
+	since := unreachableSince.Load()
+	return since != 0 && time.Since(time.Unix(0, since)) < offlineRecheckInterval
+}
+
+// markUnreachable switches to offline mode for a while if err means the server
+// couldn't be reached. It reports whether it did.
+func markUnreachable(err error) bool {
+	if !isConnectError(err) {
+		return false
+	}
+
+	unreachableSince.Store(time.Now().UnixNano())
+	return true
+}
+
+// isConnectError reports whether err happened before a connection to the server was
+// made, i.e. the host couldn't be resolved or dialed. Timeouts and resets of an
+// established connection are not treated as the server being unreachable.
+func isConnectError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// cachedModDetails serves FetchModDetails offline. The latest version is the newest
+// one in the package cache, since newer versions in the package index can't be
+// downloaded. The metrics come from the package index when there is one.
+func cachedModDetails(modAuthor, modName string) (*ModDetailsResponse, error) {
+	versions, err := CachedPackageVersions(modAuthor, modName)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("package %s-%s: %w", modAuthor, modName, ErrNotCached)
+	}
+
+	details := &ModDetailsResponse{LatestVersion: versions[0]}
+	if pkg, err := FindIndexPackage(modAuthor, modName); err == nil {
+		details.Downloads = pkg.Downloads()
+		details.RatingScore = pkg.RatingScore
+	}
+	return details, nil
+}
+
+// CachedPackageVersions lists the versions of the package in the package cache, newest first.
+func CachedPackageVersions(modAuthor, modName string) ([]string, error) {
+	prefix := modAuthor + "-" + modName + "-"
+	archives, err := filepath.Glob(filepath.Join(filesystem.GetDefaultPath(), filesystem.DefaultCacheDir, PackagesCacheDir, prefix+"*.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, archive := range archives {
+		version := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(archive), prefix), ".zip")
+		// Skip packages whose name only starts with this one, e.g. Author-Name-Extra-1.0.0.
+		if !strings.Contains(version, "-") {
+			versions = append(versions, version)
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) > 0
+	})
+	return versions, nil
+}
+
+// IsPackageCached reports whether the package version is in the package cache.
+func IsPackageCached(modAuthor, modName, modVersion string) bool {
+	_, err := os.Stat(PackageCachePath(modAuthor, modName, modVersion))
+	return err == nil
+}
+
+// searchIndex serves GlobalListMods from the package index.
+func searchIndex(ordering OrderingType, sectionType SectionType, query string, page int) ([]GlobalModView, error) {
+	packages, err := LoadPackageIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	category := map[SectionType]string{
+		Mods:              "Mods",
+		AssetReplacements: "Asset Replacements",
+		Libraries:         "Libraries",
+		Modpacks:          "Modpacks",
+	}[sectionType]
+	query = strings.ToLower(query)
+
+	var matches []*IndexPackage
+	for i := range packages {
+		pkg := &packages[i]
+		if pkg.IsDeprecated || pkg.Latest() == nil {
+			continue
+		}
+		if category != "" && !containsString(pkg.Categories, category) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(pkg.FullName), query) &&
+			!strings.Contains(strings.ToLower(pkg.Latest().Description), query) {
+			continue
+		}
+		matches = append(matches, pkg)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		switch ordering {
+		case Newest:
+			return matches[i].DateCreated.After(matches[j].DateCreated)
+		case MostDownloaded:
+			return matches[i].Downloads() > matches[j].Downloads()
+		case TopRated:
+			return matches[i].RatingScore > matches[j].RatingScore
+		default:
+			return matches[i].DateUpdated.After(matches[j].DateUpdated)
+		}
+	})
+
+	var mods []GlobalModView
+	for i := (page - 1) * offlinePageSize; i >= 0 && i < len(matches) && i < page*offlinePageSize; i++ {
+		mods = append(mods, GlobalModView{
+			ModAuthor:  matches[i].Owner,
+			ModName:    matches[i].Name,
+			ModPicture: matches[i].Latest().Icon,
+		})
+	}
+	return mods, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
+	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -19,11 +20,20 @@ type ModDetailsResponse struct {
 	LatestVersion string `json:"latest_version"`
 }
 
+// FetchModDetails fetches the metrics and latest version of a package. In offline mode
+// they come from the cached package index or the package cache.
 func FetchModDetails(modAuthor, modName string) (*ModDetailsResponse, error) {
+	if IsOffline() {
+		return cachedModDetails(modAuthor, modName)
+	}
+
 	url := fmt.Sprintf("https://thunderstore.io/api/v1/package-metrics/%s/%s", modAuthor, modName)
 
-	resp, err := http.Get(url)
+	resp, err := HTTPClient.Get(url)
 	if err != nil {
+		if markUnreachable(err) {
+			return cachedModDetails(modAuthor, modName)
+		}
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -45,65 +55,82 @@ func FetchModDetails(modAuthor, modName string) (*ModDetailsResponse, error) {
 	return &modInfo, nil
 }
 
-// DownloadModPackage downloads the specified mod package as a zip file to a temporary location.
-func DownloadModPackage(modAuthor, modName, modVersion string) (string, error) {
-	downloadURL := fmt.Sprintf("https://gcdn.thunderstore.io/live/repository/packages/%s-%s-%s.zip", modAuthor, modName, modVersion)
-
-	// Attempt to download the mod with retries for handling rate limits or temporary network issues.
-	maxRetries := 5
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		tmpFileName, err := tryDownloadMod(downloadURL)
-		if err == nil {
-			return tmpFileName, nil
-		}
+// PackagesCacheDir holds the downloaded packages inside the cache dir.
+const PackagesCacheDir = "Packages"
 
-		if attempt < maxRetries && err == errTooManyRequests {
-			time.Sleep(2 * time.Second) // Sleep before retrying.
-			continue
-		}
+// PackageRef names a specific version of a Thunderstore package.
+type PackageRef struct {
+	Author  string `json:"author"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
 
-		return "", err // Return the error if max retries reached or other error occurred.
-	}
+func (p PackageRef) String() string {
+	return fmt.Sprintf("%s-%s-%s", p.Author, p.Name, p.Version)
+}
 
-	return "", fmt.Errorf("failed to download mod after %d attempts", maxRetries)
+// PackageCachePath returns where the package zip is kept in the package cache.
+func PackageCachePath(modAuthor, modName, modVersion string) string {
+	return filepath.Join(PackageCacheDir(), fmt.Sprintf("%s-%s-%s.zip", modAuthor, modName, modVersion))
 }
 
-// tryDownloadMod performs a single attempt to download the mod from the given URL.
-func tryDownloadMod(downloadURL string) (string, error) {
-	resp, err := http.Get(downloadURL)
-	if err != nil {
-		return "", fmt.Errorf("error making download request: %w", err)
+func packageDownloadRequest(pkg PackageRef, expected ExpectedFile) DownloadRequest {
+	return DownloadRequest{
+		URL:      fmt.Sprintf("https://gcdn.thunderstore.io/live/repository/packages/%s.zip", pkg),
+		Path:     PackageCachePath(pkg.Author, pkg.Name, pkg.Version),
+		Expected: expected,
 	}
-	defer resp.Body.Close()
+}
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-		return saveModToFile(resp.Body)
-	case http.StatusTooManyRequests:
-		return "", errTooManyRequests // Custom error to indicate retry.
-	default:
-		return "", fmt.Errorf("received non-OK response status: %s", resp.Status)
-	}
+// DownloadModPackage downloads the specified mod package as a zip file into the package cache.
+// The returned zip belongs to the cache, callers must not remove it. Older packages are
+// dropped from the cache when it grows past the configured cache size.
+// The download is checked against the file size in the cached package index.
+func DownloadModPackage(modAuthor, modName, modVersion string) (string, error) {
+	pkg := PackageRef{modAuthor, modName, modVersion}
+	return DownloadModPackageExpecting(modAuthor, modName, modVersion, indexExpectedFile(pkg))
 }
 
-// errTooManyRequests is a custom error to indicate that the API has returned a rate limit response.
-var errTooManyRequests = fmt.Errorf("received too many requests response")
+// DownloadModPackageExpecting downloads the specified mod package like DownloadModPackage,
+// and verifies it against the size and hash the package index provides.
+func DownloadModPackageExpecting(modAuthor, modName, modVersion string, expected ExpectedFile) (string, error) {
+	req := packageDownloadRequest(PackageRef{modAuthor, modName, modVersion}, expected)
+	if err := DefaultDownloader.Download(context.Background(), req); err != nil {
+		return "", err
+	}
+	if err := trimPackageCacheToConfig(req.Path); err != nil {
+		return "", fmt.Errorf("error trimming package cache: %w", err)
+	}
 
-// saveModToFile saves the mod from the response body to a temporary file.
-func saveModToFile(body io.Reader) (string, error) {
-	tmpFile, err := os.CreateTemp("", "mod-*.zip")
-	if err != nil {
-		return "", fmt.Errorf("error creating temp file: %w", err)
+	return req.Path, nil
+}
+
+// DownloadModPackages downloads the packages into the package cache in parallel.
+func DownloadModPackages(packages []PackageRef) error {
+	var reqs []DownloadRequest
+	for _, pkg := range packages {
+		reqs = append(reqs, packageDownloadRequest(pkg, indexExpectedFile(pkg)))
 	}
-	defer tmpFile.Close()
 
-	if _, err := io.Copy(tmpFile, body); err != nil {
-		return "", fmt.Errorf("error writing to temp file: %w", err)
+	var errs []error
+	var used []string
+	for i, result := range DefaultDownloader.DownloadAll(context.Background(), reqs) {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("error downloading %s: %w", packages[i], result.Err))
+			continue
+		}
+		used = append(used, result.Request.Path)
+	}
+	if err := trimPackageCacheToConfig(used...); err != nil {
+		errs = append(errs, fmt.Errorf("error trimming package cache: %w", err))
 	}
 
-	return tmpFile.Name(), nil
+	return errors.Join(errs...)
 }
 
+// errTooManyRequests is a custom error to indicate that the API has returned a rate limit response.
+var errTooManyRequests = fmt.Errorf("received too many requests response")
+
 type OrderingType string
 
 const (
@@ -129,21 +156,29 @@ type GlobalModView struct {
 }
 
 // GlobalListMods fetches and parses the mod list from Thunderstore.
+// In offline mode the cached package index is searched instead.
 func GlobalListMods(ordering OrderingType, sectionType SectionType, query string, page int) ([]GlobalModView, error) {
+	if IsOffline() {
+		return searchIndex(ordering, sectionType, query, page)
+	}
+
 	document, err := fetchModsDocument(ordering, sectionType, query, page)
 	if err != nil {
+		if markUnreachable(err) {
+			return searchIndex(ordering, sectionType, query, page)
+		}
 		return nil, fmt.Errorf("error fetching mods document: %w", err)
 	}
 
 	return parseModsDocument(document), nil
 }
 
-// fetchModsDocument retrieves the HTML document from Thunderstore.
+// fetchModsDocument retrieves the HTML document of the configured community from Thunderstore.
 func fetchModsDocument(ordering OrderingType, sectionType SectionType, query string, page int) (*goquery.Document, error) {
 	encodedQuery := url.QueryEscape(query)
-	reqUrl := fmt.Sprintf("https://thunderstore.io/c/lethal-company/?q=%s&ordering=%s&section=%s&page=%d", encodedQuery, ordering, sectionType, page)
+	reqUrl := communityURL(fmt.Sprintf("?q=%s&ordering=%s&section=%s&page=%d", encodedQuery, ordering, sectionType, page))
 
-	response, err := http.Get(reqUrl)
+	response, err := HTTPClient.Get(reqUrl)
 	if err != nil {
 		return nil, err
 	}
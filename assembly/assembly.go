@@ -0,0 +1,403 @@
+package assembly
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	bepInPluginAttribute          = "BepInEx.BepInPlugin"
+	bepInDependencyAttribute      = "BepInEx.BepInDependency"
+	bepInIncompatibilityAttribute = "BepInEx.BepInIncompatibility"
+
+	// dependencySoft is the SoftDependency flag of BepInDependency.DependencyFlags.
+	dependencySoft = 2
+)
+
+// Dependency is a [BepInDependency] attribute of a plugin.
+type Dependency struct {
+	GUID           string `json:"guid"`
+	MinimumVersion string `json:"minimum_version"`
+	Soft           bool   `json:"soft"`
+}
+
+// Plugin is a class marked with [BepInPlugin(guid, name, version)].
+type Plugin struct {
+	GUID              string       `json:"guid"`
+	Name              string       `json:"name"`
+	Version           string       `json:"version"`
+	TypeName          string       `json:"type_name"`
+	Dependencies      []Dependency `json:"dependencies"`
+	Incompatibilities []string     `json:"incompatibilities"`
+}
+
+// Reference is an assembly referenced by the assembly.
+type Reference struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Info is the metadata read from a .NET assembly.
+type Info struct {
+	Path       string      `json:"path"`
+	Name       string      `json:"name"`
+	Version    string      `json:"version"`
+	Plugins    []Plugin    `json:"plugins"`
+	References []Reference `json:"references"`
+}
+
+// ReadFile reads the metadata of the assembly at path.
+// ErrNotDotNet is returned for native dlls.
+func ReadFile(path string) (*Info, error) {
+	image, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := Read(image)
+	if err != nil {
+		return nil, err
+	}
+	info.Path = path
+	return info, nil
+}
+
+// ReadDir reads every .NET assembly under dir. Native dlls are skipped, and dlls
+// that can't be read are logged and skipped, so one broken file doesn't hide the others.
+func ReadDir(dir string) ([]Info, error) {
+	var infos []Info
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".dll") {
+			return nil
+		}
+
+		info, err := ReadFile(path)
+		if errors.Is(err, ErrNotDotNet) {
+			return nil
+		} else if err != nil {
+			log.Printf("Skipping unreadable assembly %s: %v\n", path, err)
+			return nil
+		}
+
+		infos = append(infos, *info)
+		return nil
+	})
+
+	return infos, err
+}
+
+// Read parses the metadata of an assembly image.
+func Read(image []byte) (*Info, error) {
+	md, err := parseMetadata(image)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	if md.rowCount(tableAssembly) > 0 {
+		row, err := md.row(tableAssembly, 1)
+		if err != nil {
+			return nil, err
+		}
+		info.Version = fmt.Sprintf("%d.%d.%d.%d", row[1], row[2], row[3], row[4])
+		info.Name = md.string(row[7])
+	}
+
+	for rid := 1; rid <= md.rowCount(tableAssemblyRef); rid++ {
+		row, err := md.row(tableAssemblyRef, rid)
+		if err != nil {
+			return nil, err
+		}
+		info.References = append(info.References, Reference{
+			Name:    md.string(row[6]),
+			Version: fmt.Sprintf("%d.%d.%d.%d", row[0], row[1], row[2], row[3]),
+		})
+	}
+
+	info.Plugins, err = readPlugins(md)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// readPlugins collects the BepInEx attributes of every type definition.
+func readPlugins(md *metadata) ([]Plugin, error) {
+	plugins := map[int]*Plugin{}
+	var order []int
+
+	pluginFor := func(typeRid int) *Plugin {
+		if plugin, ok := plugins[typeRid]; ok {
+			return plugin
+		}
+		plugins[typeRid] = &Plugin{TypeName: md.typeDefName(typeRid)}
+		order = append(order, typeRid)
+		return plugins[typeRid]
+	}
+
+	for rid := 1; rid <= md.rowCount(tableCustomAttribute); rid++ {
+		row, err := md.row(tableCustomAttribute, rid)
+		if err != nil {
+			return nil, err
+		}
+
+		parentTable, parentRid := decodeCoded(hasCustomAttribute, row[0])
+		if parentTable != tableTypeDef {
+			continue
+		}
+
+		attributeType, signature, err := md.attributeConstructor(row[1])
+		if err != nil {
+			return nil, err
+		}
+		switch attributeType {
+		case bepInPluginAttribute, bepInDependencyAttribute, bepInIncompatibilityAttribute:
+		default:
+			continue
+		}
+
+		args := decodeFixedArgs(signature, md.blob(row[2]))
+		plugin := pluginFor(parentRid)
+		switch attributeType {
+		case bepInPluginAttribute:
+			if len(args) >= 3 {
+				plugin.GUID, plugin.Name, plugin.Version = argString(args[0]), argString(args[1]), argString(args[2])
+			}
+		case bepInDependencyAttribute:
+			if len(args) == 0 {
+				continue
+			}
+			dependency := Dependency{GUID: argString(args[0])}
+			if len(args) > 1 {
+				switch value := args[1].(type) {
+				case string:
+					dependency.MinimumVersion = value
+				case int64:
+					dependency.Soft = value&dependencySoft != 0
+				}
+			}
+			plugin.Dependencies = append(plugin.Dependencies, dependency)
+		case bepInIncompatibilityAttribute:
+			if len(args) > 0 {
+				plugin.Incompatibilities = append(plugin.Incompatibilities, argString(args[0]))
+			}
+		}
+	}
+
+	var out []Plugin
+	for _, rid := range order {
+		// Types with only dependency attributes are not plugins by themselves.
+		if plugins[rid].GUID != "" {
+			out = append(out, *plugins[rid])
+		}
+	}
+	return out, nil
+}
+
+// attributeConstructor resolves a CustomAttributeType coded index into the
+// full name of the attribute type and the constructor signature.
+func (md *metadata) attributeConstructor(value uint32) (string, []byte, error) {
+	table, rid := decodeCoded(customAttributeType, value)
+	switch table {
+	case tableMemberRef:
+		row, err := md.row(tableMemberRef, rid)
+		if err != nil {
+			return "", nil, err
+		}
+		parentTable, parentRid := decodeCoded(memberRefParent, row[0])
+		signature := md.blob(row[2])
+		switch parentTable {
+		case tableTypeRef:
+			return md.typeRefName(parentRid), signature, nil
+		case tableTypeDef:
+			return md.typeDefName(parentRid), signature, nil
+		}
+	case tableMethodDef:
+		row, err := md.row(tableMethodDef, rid)
+		if err != nil {
+			return "", nil, err
+		}
+		return md.typeDefName(md.methodOwner(rid)), md.blob(row[4]), nil
+	}
+	return "", nil, nil
+}
+
+// methodOwner finds the type definition whose method list contains the method.
+func (md *metadata) methodOwner(methodRid int) int {
+	owner := 0
+	for rid := 1; rid <= md.rowCount(tableTypeDef); rid++ {
+		row, err := md.row(tableTypeDef, rid)
+		if err != nil || int(row[5]) > methodRid {
+			break
+		}
+		owner = rid
+	}
+	return owner
+}
+
+// typeRefName returns the full name of the type reference, or "" for an invalid row.
+func (md *metadata) typeRefName(rid int) string {
+	row, err := md.row(tableTypeRef, rid)
+	if err != nil {
+		return ""
+	}
+	return joinTypeName(md.string(row[2]), md.string(row[1]))
+}
+
+// typeDefName returns the full name of the type definition, or "" for an invalid row.
+func (md *metadata) typeDefName(rid int) string {
+	row, err := md.row(tableTypeDef, rid)
+	if err != nil {
+		return ""
+	}
+	return joinTypeName(md.string(row[2]), md.string(row[1]))
+}
+
+func joinTypeName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// Element types used in constructor signatures, see ECMA-335 II.23.1.16.
+const (
+	elementBoolean   = 0x02
+	elementChar      = 0x03
+	elementI1        = 0x04
+	elementU1        = 0x05
+	elementI2        = 0x06
+	elementU2        = 0x07
+	elementI4        = 0x08
+	elementU4        = 0x09
+	elementI8        = 0x0A
+	elementU8        = 0x0B
+	elementR4        = 0x0C
+	elementR8        = 0x0D
+	elementString    = 0x0E
+	elementValueType = 0x11
+	elementClass     = 0x12
+)
+
+// decodeFixedArgs decodes the fixed constructor arguments of a custom attribute value blob.
+// Strings are returned as string (or nil), integers as int64, floats as float64 and booleans as bool.
+// Enums are assumed to have an int32 underlying type. Decoding stops at the first unsupported type.
+func decodeFixedArgs(signature, value []byte) []any {
+	if len(signature) < 3 || len(value) < 2 || binary.LittleEndian.Uint16(value) != 0x0001 {
+		return nil
+	}
+
+	paramCount, size, ok := decompressUint(signature[1:])
+	if !ok {
+		return nil
+	}
+	sig := signature[1+size:]
+	if len(sig) == 0 {
+		return nil
+	}
+	sig = sig[1:] // Return type, always void for constructors.
+
+	value = value[2:]
+	var args []any
+	for i := 0; i < int(paramCount) && len(sig) > 0; i++ {
+		elementType := sig[0]
+		sig = sig[1:]
+
+		var arg any
+		var n int
+		switch elementType {
+		case elementString, elementClass:
+			if elementType == elementClass {
+				// System.Type arguments are serialized as strings.
+				if _, size, ok := decompressUint(sig); ok {
+					sig = sig[size:]
+				}
+			}
+			arg, n = readSerString(value)
+		case elementValueType:
+			if _, size, ok := decompressUint(sig); ok {
+				sig = sig[size:]
+			}
+			arg, n = readInt(value, 4, true)
+		case elementBoolean:
+			if len(value) >= 1 {
+				arg, n = value[0] != 0, 1
+			}
+		case elementI1, elementU1:
+			arg, n = readInt(value, 1, elementType == elementI1)
+		case elementI2, elementU2, elementChar:
+			arg, n = readInt(value, 2, elementType == elementI2)
+		case elementI4, elementU4:
+			arg, n = readInt(value, 4, elementType == elementI4)
+		case elementI8, elementU8:
+			arg, n = readInt(value, 8, elementType == elementI8)
+		case elementR4:
+			if len(value) >= 4 {
+				arg, n = float64(math.Float32frombits(binary.LittleEndian.Uint32(value))), 4
+			}
+		case elementR8:
+			if len(value) >= 8 {
+				arg, n = math.Float64frombits(binary.LittleEndian.Uint64(value)), 8
+			}
+		}
+
+		if n == 0 {
+			return args
+		}
+		args = append(args, arg)
+		value = value[n:]
+	}
+
+	return args
+}
+
+// readSerString reads a SerString: 0xFF for null, otherwise a compressed length and UTF-8 bytes.
+func readSerString(data []byte) (any, int) {
+	if len(data) == 0 {
+		return nil, 0
+	}
+	if data[0] == 0xFF {
+		return nil, 1
+	}
+	length, size, ok := decompressUint(data)
+	if !ok || size+int(length) > len(data) {
+		return nil, 0
+	}
+	text := data[size : size+int(length)]
+	if !utf8.Valid(text) {
+		return nil, 0
+	}
+	return string(text), size + int(length)
+}
+
+// readInt reads a little endian integer of the given size.
+func readInt(data []byte, size int, signed bool) (any, int) {
+	if len(data) < size {
+		return nil, 0
+	}
+	var value uint64
+	for i := size - 1; i >= 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+	if signed {
+		shift := 64 - 8*size
+		return int64(value<<shift) >> shift, size
+	}
+	return int64(value), size
+}
+
+// argString returns the argument as a string, or "" if it is not one.
+func argString(arg any) string {
+	text, _ := arg.(string)
+	return text
+}
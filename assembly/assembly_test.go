@@ -0,0 +1,83 @@
+package assembly
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testdata/ExamplePlugin.dll is built from testdata/ExamplePlugin.cs against a stub BepInEx.dll.
+func TestReadFile(t *testing.T) {
+	info, err := ReadFile(filepath.Join("testdata", "ExamplePlugin.dll"))
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+
+	if info.Name != "ExamplePlugin" || info.Version != "1.2.3.0" {
+		t.Errorf("assembly = %s %s, want ExamplePlugin 1.2.3.0", info.Name, info.Version)
+	}
+
+	foundBepInEx := false
+	for _, reference := range info.References {
+		if reference.Name == "BepInEx" {
+			foundBepInEx = true
+		}
+	}
+	if !foundBepInEx {
+		t.Errorf("BepInEx reference not found in %v", info.References)
+	}
+
+	if len(info.Plugins) != 1 {
+		t.Fatalf("found %d plugins, want 1", len(info.Plugins))
+	}
+
+	plugin := info.Plugins[0]
+	if plugin.GUID != "com.example.plugin" || plugin.Name != "Example Plugin" || plugin.Version != "1.2.3" {
+		t.Errorf("unexpected plugin: %+v", plugin)
+	}
+
+	want := []Dependency{
+		{GUID: "evaisa.lethallib"},
+		{GUID: "com.example.soft", Soft: true},
+		{GUID: "com.example.versioned", MinimumVersion: "2.0.0"},
+	}
+	if len(plugin.Dependencies) != len(want) {
+		t.Fatalf("found %d dependencies, want %d", len(plugin.Dependencies), len(want))
+	}
+	for i, dependency := range want {
+		if plugin.Dependencies[i] != dependency {
+			t.Errorf("dependency %d = %+v, want %+v", i, plugin.Dependencies[i], dependency)
+		}
+	}
+
+	if len(plugin.Incompatibilities) != 1 || plugin.Incompatibilities[0] != "com.example.bad" {
+		t.Errorf("unexpected incompatibilities: %v", plugin.Incompatibilities)
+	}
+}
+
+func TestReadDirSkipsUnreadableDlls(t *testing.T) {
+	dir := t.TempDir()
+	image, err := os.ReadFile(filepath.Join("testdata", "ExamplePlugin.dll"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"ExamplePlugin.dll": image,
+		"NotAnImage.dll":    []byte("not a PE file"),
+		"Truncated.dll":     image[:len(image)/2],
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() failed: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Name != "ExamplePlugin" {
+		t.Errorf("ReadDir() = %+v, want only ExamplePlugin", infos)
+	}
+}
@@ -0,0 +1,440 @@
+package assembly
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrNotDotNet is returned for PE files without CLI metadata, e.g. native dlls.
+var ErrNotDotNet = errors.New("not a .NET assembly")
+
+// Metadata table ids, see ECMA-335 II.22.
+const (
+	tableModule                 = 0x00
+	tableTypeRef                = 0x01
+	tableTypeDef                = 0x02
+	tableFieldPtr               = 0x03
+	tableField                  = 0x04
+	tableMethodPtr              = 0x05
+	tableMethodDef              = 0x06
+	tableParamPtr               = 0x07
+	tableParam                  = 0x08
+	tableInterfaceImpl          = 0x09
+	tableMemberRef              = 0x0A
+	tableConstant               = 0x0B
+	tableCustomAttribute        = 0x0C
+	tableFieldMarshal           = 0x0D
+	tableDeclSecurity           = 0x0E
+	tableClassLayout            = 0x0F
+	tableFieldLayout            = 0x10
+	tableStandAloneSig          = 0x11
+	tableEventMap               = 0x12
+	tableEventPtr               = 0x13
+	tableEvent                  = 0x14
+	tablePropertyMap            = 0x15
+	tablePropertyPtr            = 0x16
+	tableProperty               = 0x17
+	tableMethodSemantics        = 0x18
+	tableMethodImpl             = 0x19
+	tableModuleRef              = 0x1A
+	tableTypeSpec               = 0x1B
+	tableImplMap                = 0x1C
+	tableFieldRVA               = 0x1D
+	tableENCLog                 = 0x1E
+	tableENCMap                 = 0x1F
+	tableAssembly               = 0x20
+	tableAssemblyProcessor      = 0x21
+	tableAssemblyOS             = 0x22
+	tableAssemblyRef            = 0x23
+	tableAssemblyRefProcessor   = 0x24
+	tableAssemblyRefOS          = 0x25
+	tableFile                   = 0x26
+	tableExportedType           = 0x27
+	tableManifestResource       = 0x28
+	tableNestedClass            = 0x29
+	tableGenericParam           = 0x2A
+	tableMethodSpec             = 0x2B
+	tableGenericParamConstraint = 0x2C
+	tableCount                  = 0x40
+	tableUnused                 = -1
+)
+
+// codedIndex describes a coded index: the tag bits and the tables it can point into.
+type codedIndex struct {
+	tagBits int
+	tables  []int
+}
+
+var (
+	typeDefOrRef        = codedIndex{2, []int{tableTypeDef, tableTypeRef, tableTypeSpec}}
+	hasConstant         = codedIndex{2, []int{tableField, tableParam, tableProperty}}
+	hasCustomAttribute  = codedIndex{5, []int{tableMethodDef, tableField, tableTypeRef, tableTypeDef, tableParam, tableInterfaceImpl, tableMemberRef, tableModule, tableDeclSecurity, tableProperty, tableEvent, tableStandAloneSig, tableModuleRef, tableTypeSpec, tableAssembly, tableAssemblyRef, tableFile, tableExportedType, tableManifestResource, tableGenericParam, tableGenericParamConstraint, tableMethodSpec}}
+	hasFieldMarshal     = codedIndex{1, []int{tableField, tableParam}}
+	hasDeclSecurity     = codedIndex{2, []int{tableTypeDef, tableMethodDef, tableAssembly}}
+	memberRefParent     = codedIndex{3, []int{tableTypeDef, tableTypeRef, tableModuleRef, tableMethodDef, tableTypeSpec}}
+	hasSemantics        = codedIndex{1, []int{tableEvent, tableProperty}}
+	methodDefOrRef      = codedIndex{1, []int{tableMethodDef, tableMemberRef}}
+	memberForwarded     = codedIndex{1, []int{tableField, tableMethodDef}}
+	implementation      = codedIndex{2, []int{tableFile, tableAssemblyRef, tableExportedType}}
+	customAttributeType = codedIndex{3, []int{tableUnused, tableUnused, tableMethodDef, tableMemberRef, tableUnused}}
+	resolutionScope     = codedIndex{2, []int{tableModule, tableModuleRef, tableAssemblyRef, tableTypeRef}}
+	typeOrMethodDef     = codedIndex{1, []int{tableTypeDef, tableMethodDef}}
+)
+
+// column is a single column of a metadata table. Exactly one of the fields is set.
+type column struct {
+	fixed int // size in bytes of a constant column
+	heap  byte
+	table int
+	coded *codedIndex
+}
+
+const (
+	heapString = 's'
+	heapGUID   = 'g'
+	heapBlob   = 'b'
+)
+
+func fixed(size int) column     { return column{fixed: size, table: tableUnused} }
+func str() column               { return column{heap: heapString, table: tableUnused} }
+func guid() column              { return column{heap: heapGUID, table: tableUnused} }
+func blob() column              { return column{heap: heapBlob, table: tableUnused} }
+func index(table int) column    { return column{table: table} }
+func coded(c codedIndex) column { return column{coded: &c, table: tableUnused} }
+
+// tableSchemas lists the columns of every table, see ECMA-335 II.22.
+var tableSchemas = map[int][]column{
+	tableModule:                 {fixed(2), str(), guid(), guid(), guid()},
+	tableTypeRef:                {coded(resolutionScope), str(), str()},
+	tableTypeDef:                {fixed(4), str(), str(), coded(typeDefOrRef), index(tableField), index(tableMethodDef)},
+	tableFieldPtr:               {index(tableField)},
+	tableField:                  {fixed(2), str(), blob()},
+	tableMethodPtr:              {index(tableMethodDef)},
+	tableMethodDef:              {fixed(4), fixed(2), fixed(2), str(), blob(), index(tableParam)},
+	tableParamPtr:               {index(tableParam)},
+	tableParam:                  {fixed(2), fixed(2), str()},
+	tableInterfaceImpl:          {index(tableTypeDef), coded(typeDefOrRef)},
+	tableMemberRef:              {coded(memberRefParent), str(), blob()},
+	tableConstant:               {fixed(2), coded(hasConstant), blob()},
+	tableCustomAttribute:        {coded(hasCustomAttribute), coded(customAttributeType), blob()},
+	tableFieldMarshal:           {coded(hasFieldMarshal), blob()},
+	tableDeclSecurity:           {fixed(2), coded(hasDeclSecurity), blob()},
+	tableClassLayout:            {fixed(2), fixed(4), index(tableTypeDef)},
+	tableFieldLayout:            {fixed(4), index(tableField)},
+	tableStandAloneSig:          {blob()},
+	tableEventMap:               {index(tableTypeDef), index(tableEvent)},
+	tableEventPtr:               {index(tableEvent)},
+	tableEvent:                  {fixed(2), str(), coded(typeDefOrRef)},
+	tablePropertyMap:            {index(tableTypeDef), index(tableProperty)},
+	tablePropertyPtr:            {index(tableProperty)},
+	tableProperty:               {fixed(2), str(), blob()},
+	tableMethodSemantics:        {fixed(2), index(tableMethodDef), coded(hasSemantics)},
+	tableMethodImpl:             {index(tableTypeDef), coded(methodDefOrRef), coded(methodDefOrRef)},
+	tableModuleRef:              {str()},
+	tableTypeSpec:               {blob()},
+	tableImplMap:                {fixed(2), coded(memberForwarded), str(), index(tableModuleRef)},
+	tableFieldRVA:               {fixed(4), index(tableField)},
+	tableENCLog:                 {fixed(4), fixed(4)},
+	tableENCMap:                 {fixed(4)},
+	tableAssembly:               {fixed(4), fixed(2), fixed(2), fixed(2), fixed(2), fixed(4), blob(), str(), str()},
+	tableAssemblyProcessor:      {fixed(4)},
+	tableAssemblyOS:             {fixed(4), fixed(4), fixed(4)},
+	tableAssemblyRef:            {fixed(2), fixed(2), fixed(2), fixed(2), fixed(4), blob(), str(), str(), blob()},
+	tableAssemblyRefProcessor:   {fixed(4), index(tableAssemblyRef)},
+	tableAssemblyRefOS:          {fixed(4), fixed(4), fixed(4), index(tableAssemblyRef)},
+	tableFile:                   {fixed(4), str(), blob()},
+	tableExportedType:           {fixed(4), fixed(4), str(), str(), coded(implementation)},
+	tableManifestResource:       {fixed(4), fixed(4), str(), coded(implementation)},
+	tableNestedClass:            {index(tableTypeDef), index(tableTypeDef)},
+	tableGenericParam:           {fixed(2), fixed(2), coded(typeOrMethodDef), str()},
+	tableMethodSpec:             {coded(methodDefOrRef), blob()},
+	tableGenericParamConstraint: {index(tableGenericParam), coded(typeDefOrRef)},
+}
+
+// metadata gives access to the heaps and tables of an assembly.
+type metadata struct {
+	strings []byte
+	blobs   []byte
+
+	heapSizes byte
+	rows      [tableCount]uint32
+	offsets   [tableCount]int
+	rowSizes  [tableCount]int
+	colSizes  [tableCount][]int
+	tables    []byte
+}
+
+// parseMetadata locates the CLI metadata in a PE image and parses the table stream.
+func parseMetadata(image []byte) (*metadata, error) {
+	file, err := pe.NewFile(bytes.NewReader(image))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var clrDirectory pe.DataDirectory
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if header.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR {
+			clrDirectory = header.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR]
+		}
+	case *pe.OptionalHeader64:
+		if header.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR {
+			clrDirectory = header.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR]
+		}
+	}
+	if clrDirectory.VirtualAddress == 0 {
+		return nil, ErrNotDotNet
+	}
+
+	cliHeader, err := readRVA(file, image, clrDirectory.VirtualAddress, 16)
+	if err != nil {
+		return nil, err
+	}
+	metadataRVA := binary.LittleEndian.Uint32(cliHeader[8:])
+	metadataSize := binary.LittleEndian.Uint32(cliHeader[12:])
+
+	root, err := readRVA(file, image, metadataRVA, metadataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMetadataRoot(root)
+}
+
+// readRVA returns size bytes of the image starting at the relative virtual address.
+func readRVA(file *pe.File, image []byte, rva, size uint32) ([]byte, error) {
+	for _, section := range file.Sections {
+		if rva >= section.VirtualAddress && rva < section.VirtualAddress+section.VirtualSize {
+			start := int64(section.Offset) + int64(rva-section.VirtualAddress)
+			end := start + int64(size)
+			if end > int64(len(image)) {
+				return nil, fmt.Errorf("rva 0x%x is out of bounds", rva)
+			}
+			return image[start:end], nil
+		}
+	}
+	return nil, fmt.Errorf("rva 0x%x is not in any section", rva)
+}
+
+// parseMetadataRoot parses the metadata root and its stream headers, see ECMA-335 II.24.2.
+func parseMetadataRoot(root []byte) (*metadata, error) {
+	if len(root) < 20 || binary.LittleEndian.Uint32(root) != 0x424A5342 {
+		return nil, fmt.Errorf("invalid metadata signature")
+	}
+
+	versionLength := int(binary.LittleEndian.Uint32(root[12:]))
+	offset := 16 + versionLength
+	if offset+4 > len(root) {
+		return nil, fmt.Errorf("truncated metadata root")
+	}
+	streamCount := int(binary.LittleEndian.Uint16(root[offset+2:]))
+	offset += 4
+
+	md := &metadata{}
+	var tableStream []byte
+	for i := 0; i < streamCount; i++ {
+		if offset+8 > len(root) {
+			return nil, fmt.Errorf("truncated stream header")
+		}
+		streamOffset := binary.LittleEndian.Uint32(root[offset:])
+		streamSize := binary.LittleEndian.Uint32(root[offset+4:])
+		offset += 8
+
+		nameEnd := bytes.IndexByte(root[offset:], 0)
+		if nameEnd < 0 {
+			return nil, fmt.Errorf("truncated stream name")
+		}
+		name := string(root[offset : offset+nameEnd])
+		offset += (nameEnd + 4) &^ 3
+
+		if uint64(streamOffset)+uint64(streamSize) > uint64(len(root)) {
+			return nil, fmt.Errorf("stream %s is out of bounds", name)
+		}
+		stream := root[streamOffset : streamOffset+streamSize]
+
+		switch name {
+		case "#~", "#-":
+			tableStream = stream
+		case "#Strings":
+			md.strings = stream
+		case "#Blob":
+			md.blobs = stream
+		}
+	}
+
+	if tableStream == nil {
+		return nil, fmt.Errorf("metadata has no table stream")
+	}
+	if err := md.parseTables(tableStream); err != nil {
+		return nil, err
+	}
+
+	return md, nil
+}
+
+// parseTables reads the row counts of the table stream and computes the table layout.
+func (md *metadata) parseTables(stream []byte) error {
+	if len(stream) < 24 {
+		return fmt.Errorf("truncated table stream")
+	}
+	md.heapSizes = stream[6]
+	valid := binary.LittleEndian.Uint64(stream[8:])
+
+	offset := 24
+	for table := 0; table < tableCount; table++ {
+		if valid&(1<<table) == 0 {
+			continue
+		}
+		if offset+4 > len(stream) {
+			return fmt.Errorf("truncated table row counts")
+		}
+		md.rows[table] = binary.LittleEndian.Uint32(stream[offset:])
+		offset += 4
+	}
+	// Uncompressed (#-) streams written with extra data have 4 more bytes here.
+	if md.heapSizes&0x40 != 0 {
+		offset += 4
+	}
+
+	for table := 0; table < tableCount; table++ {
+		if md.rows[table] == 0 {
+			continue
+		}
+		schema, known := tableSchemas[table]
+		if !known {
+			return fmt.Errorf("unknown metadata table 0x%x", table)
+		}
+
+		md.colSizes[table] = make([]int, len(schema))
+		for i, col := range schema {
+			md.colSizes[table][i] = md.columnSize(col)
+			md.rowSizes[table] += md.colSizes[table][i]
+		}
+
+		md.offsets[table] = offset
+		offset += md.rowSizes[table] * int(md.rows[table])
+	}
+
+	if offset > len(stream) {
+		return fmt.Errorf("table stream is truncated")
+	}
+	md.tables = stream
+	return nil
+}
+
+// columnSize returns the size in bytes of the column, which depends on the heap and table sizes.
+func (md *metadata) columnSize(col column) int {
+	switch {
+	case col.fixed > 0:
+		return col.fixed
+	case col.heap == heapString:
+		return md.heapIndexSize(0x01)
+	case col.heap == heapGUID:
+		return md.heapIndexSize(0x02)
+	case col.heap == heapBlob:
+		return md.heapIndexSize(0x04)
+	case col.coded != nil:
+		limit := uint32(1) << (16 - col.coded.tagBits)
+		for _, table := range col.coded.tables {
+			if table != tableUnused && md.rows[table] >= limit {
+				return 4
+			}
+		}
+		return 2
+	default:
+		if md.rows[col.table] >= 1<<16 {
+			return 4
+		}
+		return 2
+	}
+}
+
+func (md *metadata) heapIndexSize(flag byte) int {
+	if md.heapSizes&flag != 0 {
+		return 4
+	}
+	return 2
+}
+
+// rowCount returns the number of rows in the table.
+func (md *metadata) rowCount(table int) int {
+	return int(md.rows[table])
+}
+
+// row returns the column values of the 1-based row of the table.
+// Indexes read from the image are not trusted, rows outside the table are an error.
+func (md *metadata) row(table, rid int) ([]uint32, error) {
+	if table < 0 || table >= tableCount || rid < 1 || rid > md.rowCount(table) {
+		return nil, fmt.Errorf("row %d of metadata table 0x%x is out of range", rid, table)
+	}
+
+	start := md.offsets[table] + (rid-1)*md.rowSizes[table]
+	values := make([]uint32, len(md.colSizes[table]))
+	for i, size := range md.colSizes[table] {
+		switch size {
+		case 1:
+			values[i] = uint32(md.tables[start])
+		case 2:
+			values[i] = uint32(binary.LittleEndian.Uint16(md.tables[start:]))
+		case 4:
+			values[i] = binary.LittleEndian.Uint32(md.tables[start:])
+		}
+		start += size
+	}
+	return values, nil
+}
+
+// decodeCoded splits a coded index value into its table and 1-based row.
+func decodeCoded(c codedIndex, value uint32) (int, int) {
+	tag := int(value & (1<<c.tagBits - 1))
+	if tag >= len(c.tables) {
+		return tableUnused, 0
+	}
+	return c.tables[tag], int(value >> c.tagBits)
+}
+
+// string returns the null-terminated string at the #Strings heap offset.
+func (md *metadata) string(offset uint32) string {
+	if int(offset) >= len(md.strings) {
+		return ""
+	}
+	end := bytes.IndexByte(md.strings[offset:], 0)
+	if end < 0 {
+		return string(md.strings[offset:])
+	}
+	return string(md.strings[offset : int(offset)+end])
+}
+
+// blob returns the blob at the #Blob heap offset, without its length prefix.
+func (md *metadata) blob(offset uint32) []byte {
+	if int(offset) >= len(md.blobs) {
+		return nil
+	}
+	length, size, ok := decompressUint(md.blobs[offset:])
+	if !ok || int(offset)+size+int(length) > len(md.blobs) {
+		return nil
+	}
+	start := int(offset) + size
+	return md.blobs[start : start+int(length)]
+}
+
+// decompressUint reads a compressed unsigned integer, see ECMA-335 II.23.2.
+// It returns the value and the number of bytes it took.
+func decompressUint(data []byte) (uint32, int, bool) {
+	if len(data) == 0 {
+		return 0, 0, false
+	}
+	switch {
+	case data[0]&0x80 == 0:
+		return uint32(data[0]), 1, true
+	case data[0]&0xC0 == 0x80 && len(data) >= 2:
+		return uint32(data[0]&0x3F)<<8 | uint32(data[1]), 2, true
+	case data[0]&0xE0 == 0xC0 && len(data) >= 4:
+		return uint32(data[0]&0x1F)<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3]), 4, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,10 @@
+using BepInEx;
+namespace Example {
+  [BepInPlugin("com.example.plugin", "Example Plugin", "1.2.3")]
+  [BepInDependency("evaisa.lethallib")]
+  [BepInDependency("com.example.soft", BepInDependency.DependencyFlags.SoftDependency)]
+  [BepInDependency("com.example.versioned", "2.0.0")]
+  [BepInIncompatibility("com.example.bad")]
+  public class Plugin { }
+  public class NotAPlugin { }
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// EnvPrefix starts the environment variables that override config values, e.g.
+// LETHAL_CORE_DOWNLOAD_CONCURRENCY overrides download_concurrency. They are meant for
+// CI and scripted runs and are never written to the config file.
+const EnvPrefix = "LETHAL_CORE_"
+
+// BasePathEnv overrides the directory the manager keeps its data and config in.
+const BasePathEnv = EnvPrefix + "BASE_PATH"
+
+var active atomic.Pointer[Config]
+
+// Active returns the settings the packages use: the config last loaded or saved, see
+// SetActive, or the defaults, with the environment overrides applied.
+func Active() *Config {
+	config := active.Load()
+	if config == nil {
+		config = DefaultConfig()
+	} else {
+		config = config.Clone()
+	}
+
+	// Invalid overrides are reported by SetActive.
+	ApplyEnv(config)
+	return config
+}
+
+// SetActive makes config the settings the packages use. LoadConfig and SaveConfig
+// do this for every config they read or write. Environment overrides that can't be
+// applied to config are logged.
+func SetActive(config *Config) {
+	active.Store(config.Clone())
+
+	err := ApplyEnv(config.Clone())
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	// Only log overrides once, not every time the config is reloaded.
+	if previous := lastEnvError.Swap(&message); err != nil && (previous == nil || *previous != message) {
+		log.Printf("Ignoring invalid config environment overrides: %v\n", err)
+	}
+}
+
+// lastEnvError is the last error SetActive got from the environment overrides.
+var lastEnvError atomic.Pointer[string]
+
+// EnvName returns the environment variable that overrides the config key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// ApplyEnv applies the environment overrides to config. Overrides that can't be
+// parsed or don't validate are skipped and returned as *ValidationError keyed by the
+// environment variable. Lists are comma separated.
+func ApplyEnv(config *Config) error {
+	var errs []error
+
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		if key == "" || key == "-" || key == "schema_version" {
+			continue
+		}
+
+		env := EnvName(key)
+		raw, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+
+		field := value.Field(i)
+		previous := reflect.New(field.Type()).Elem()
+		previous.Set(field)
+
+		if err := setField(field, raw); err != nil {
+			errs = append(errs, &ValidationError{Key: env, Message: err.Error()})
+			continue
+		}
+		if err := Validate(config); err != nil {
+			field.Set(previous)
+
+			message := err.Error()
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				message = validationErr.Message
+			}
+			errs = append(errs, &ValidationError{Key: env, Message: message})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setField parses raw into a config field.
+func setField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected a bool, got %q", raw)
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", raw)
+		}
+		field.SetInt(parsed)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("can't be set from the environment")
+	}
+	return nil
+}
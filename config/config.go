@@ -2,54 +2,292 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
 )
 
-// Please don't the config values from inside the package.
-// It's supposed to be used by the main package.
+// Config holds the manager settings. The main package loads and saves the config file,
+// which makes it the active config, the other packages only read the settings through Active.
 type Config struct {
-	LastUsedProfile      string `json:"last_used_profile"`
+	// SchemaVersion is the version of the config file layout, see migrations.
+	SchemaVersion   int    `json:"schema_version"`
+	LastUsedProfile string `json:"last_used_profile"`
+	// Deprecated: BepInEx is cached per version now, see modmanager.ListCachedBepInEx.
 	CachedBepInExVersion string `json:"cached_bepinex_version"`
 	OtherProfilesCloned  bool   `json:"other_profiles_cloned"`
+	// Offline serves lookups, search and installs only from the caches, see api.SetOffline.
+	Offline bool `json:"offline"`
+
+	// DownloadConcurrency is how many packages are downloaded at once.
+	DownloadConcurrency int `json:"download_concurrency"`
+	// DownloadRetries is how often a rate limited or interrupted download is attempted.
+	DownloadRetries int `json:"download_retries"`
+	// Proxy is the URL of the proxy for all requests. Empty uses the proxy environment variables.
+	Proxy string `json:"proxy"`
+	// CacheSizeMB limits the size of the package cache, 0 means unlimited.
+	CacheSizeMB int64 `json:"cache_size_mb"`
+	// Community is the Thunderstore community packages are searched in.
+	Community string `json:"community"`
+
+	// LaunchMode is how LaunchGameProfile starts the game, LaunchModeSteam or LaunchModeDirect.
+	LaunchMode string `json:"launch_mode"`
+	// SteamPath is the Steam install directory. Empty looks in the usual places.
+	SteamPath string `json:"steam_path"`
+	// GamePath is the game install directory. Empty looks through the Steam libraries.
+	GamePath string `json:"game_path"`
+
+	// ImportSources are the external mod managers profiles are imported from.
+	ImportSources []string `json:"import_sources"`
 }
 
 const ConfigFileName = "config.json"
 
+const (
+	// LaunchModeSteam launches the game through Steam's -applaunch.
+	LaunchModeSteam = "steam"
+	// LaunchModeDirect starts the game executable directly.
+	LaunchModeDirect = "direct"
+)
+
+// ValidationError points at the config key with an invalid value.
+type ValidationError struct {
+	Key     string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config value for %q: %s", e.Key, e.Message)
+}
+
+// Clone returns a copy of the config.
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.ImportSources = append([]string(nil), c.ImportSources...)
+	return &clone
+}
+
+// DefaultConfig returns the config used for keys that are missing from the config file.
+func DefaultConfig() *Config {
+	return &Config{
+		SchemaVersion:       CurrentSchemaVersion,
+		LastUsedProfile:     "Default",
+		DownloadConcurrency: 4,
+		DownloadRetries:     5,
+		Community:           "lethal-company",
+		LaunchMode:          LaunchModeSteam,
+		ImportSources:       []string{"r2modman", "thunderstore", "gale"},
+	}
+}
+
 // LoadConfig reads the configuration from the file.
+// A missing file gives the default config. Older files are migrated and saved in the
+// current schema. A corrupted file is backed up next to the config and regenerated,
+// keeping the values that are still valid. Files of a newer schema are not touched and
+// give a *NewerSchemaError. The file is only written while holding its lock, see Store.
+// The loaded config becomes the active config.
 func LoadConfig(configPath string) (*Config, error) {
+	return loadConfig(configPath, false)
+}
+
+// loadConfig is LoadConfig for callers that may already hold the config file lock.
+func loadConfig(configPath string, locked bool) (*Config, error) {
 	file, err := os.ReadFile(configPath)
-	if err != nil {
+	if os.IsNotExist(err) {
+		config := DefaultConfig()
+		SetActive(config)
+		return config, nil
+	} else if err != nil {
 		return nil, err
 	}
 
-	var config Config
-	err = json.Unmarshal(file, &config)
-	if err != nil {
+	config, migrated, err := parseConfig(file, nil)
+	if err == nil && !migrated {
+		SetActive(config)
+		return config, nil
+	}
+	var newerErr *NewerSchemaError
+	if errors.As(err, &newerErr) {
 		return nil, err
 	}
 
-	return &config, nil
+	if !locked {
+		lock, err := fileutil.LockFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Unlock()
+
+		// Another process may have migrated or regenerated the file in the meantime.
+		return loadConfig(configPath, true)
+	}
+
+	if err == nil {
+		if err := SaveConfig(configPath, config); err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+
+	backupPath := fmt.Sprintf("%s.corrupt-%s", configPath, time.Now().Format("20060102-150405"))
+	if err := fileutil.WriteFile(backupPath, file, 0644); err != nil {
+		return nil, fmt.Errorf("error backing up corrupted config: %w", err)
+	}
+	log.Printf("Config %s is corrupted (%v), regenerating it. The old file was saved to %s\n", configPath, err, backupPath)
+
+	config = recoverConfig(file)
+	if err := SaveConfig(configPath, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ParseConfig parses and validates a config file, migrating it from older schema
+// versions and filling in defaults for missing keys.
+func ParseConfig(data []byte) (*Config, error) {
+	config, _, err := parseConfig(data, nil)
+	return config, err
+}
+
+// parseConfig parses the config file without the skipped keys, which get their defaults.
+// It reports whether the file had to be migrated.
+func parseConfig(data []byte, skipped map[string]bool) (*Config, bool, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, err
+	}
+	if raw == nil {
+		return nil, false, errors.New("config is not a JSON object")
+	}
+	for key := range skipped {
+		delete(raw, key)
+	}
+
+	version, err := schemaVersion(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := migrate(raw, version); err != nil {
+		return nil, false, err
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	config := DefaultConfig()
+	if err := json.Unmarshal(migrated, config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, false, &ValidationError{Key: typeErr.Field, Message: fmt.Sprintf("expected a %s, got a %s", typeErr.Type, typeErr.Value)}
+		}
+		return nil, false, err
+	}
+
+	if err := Validate(config); err != nil {
+		return nil, false, err
+	}
+
+	return config, version != CurrentSchemaVersion, nil
+}
+
+// recoverConfig parses as much of a corrupted config file as possible.
+// Keys with invalid values are dropped one by one and get their defaults.
+func recoverConfig(data []byte) *Config {
+	skipped := map[string]bool{}
+	for {
+		config, _, err := parseConfig(data, skipped)
+		if err == nil {
+			return config
+		}
+
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Key == "" || skipped[validationErr.Key] {
+			return DefaultConfig()
+		}
+		skipped[validationErr.Key] = true
+	}
+}
+
+// communityPattern matches Thunderstore community identifiers like lethal-company.
+var communityPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Validate checks the values of the config.
+func Validate(config *Config) error {
+	if config.SchemaVersion != CurrentSchemaVersion {
+		return &ValidationError{Key: "schema_version", Message: fmt.Sprintf("unsupported version %d", config.SchemaVersion)}
+	}
+	if strings.ContainsAny(config.LastUsedProfile, `/\`) || config.LastUsedProfile == ".." {
+		return &ValidationError{Key: "last_used_profile", Message: "must be a profile name, not a path"}
+	}
+	if config.DownloadConcurrency < 1 || config.DownloadConcurrency > 32 {
+		return &ValidationError{Key: "download_concurrency", Message: "must be between 1 and 32"}
+	}
+	if config.DownloadRetries < 1 || config.DownloadRetries > 20 {
+		return &ValidationError{Key: "download_retries", Message: "must be between 1 and 20"}
+	}
+	if config.Proxy != "" {
+		proxy, err := url.Parse(config.Proxy)
+		if err != nil || proxy.Host == "" || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") {
+			return &ValidationError{Key: "proxy", Message: "must be a http, https or socks5 URL"}
+		}
+	}
+	if config.CacheSizeMB < 0 {
+		return &ValidationError{Key: "cache_size_mb", Message: "must not be negative"}
+	}
+	if !communityPattern.MatchString(config.Community) {
+		return &ValidationError{Key: "community", Message: "must be a Thunderstore community identifier"}
+	}
+	if config.LaunchMode != LaunchModeSteam && config.LaunchMode != LaunchModeDirect {
+		return &ValidationError{Key: "launch_mode", Message: fmt.Sprintf("must be %q or %q", LaunchModeSteam, LaunchModeDirect)}
+	}
+	if config.SteamPath != "" && !filepath.IsAbs(config.SteamPath) {
+		return &ValidationError{Key: "steam_path", Message: "must be an absolute path"}
+	}
+	if config.GamePath != "" && !filepath.IsAbs(config.GamePath) {
+		return &ValidationError{Key: "game_path", Message: "must be an absolute path"}
+	}
+	seen := map[string]bool{}
+	for _, source := range config.ImportSources {
+		if source == "" || seen[source] {
+			return &ValidationError{Key: "import_sources", Message: fmt.Sprintf("empty or duplicate source %q", source)}
+		}
+		seen[source] = true
+	}
+
+	return nil
 }
 
-// SaveConfig writes the configuration to the file.
+// SaveConfig writes the configuration to the file and makes it the active config.
 func SaveConfig(configPath string, config *Config) error {
+	config.SchemaVersion = CurrentSchemaVersion
+
 	configFile, err := json.MarshalIndent(config, "", "    ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, configFile, 0644)
+	if err := fileutil.WriteFile(configPath, configFile, 0644); err != nil {
+		return err
+	}
+	SetActive(config)
+	return nil
 }
 
 // InitializeConfig creates a new configuration file with default settings.
 func InitializeConfig(basePath string) error {
 	configPath := filepath.Join(basePath, ConfigFileName)
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		defaultConfig := Config{
-			LastUsedProfile: "Default",
-		}
-		return SaveConfig(configPath, &defaultConfig)
+		return SaveConfig(configPath, DefaultConfig())
 	}
 	return nil
 }
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	config, err := LoadConfig(filepath.Join(t.TempDir(), ConfigFileName))
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if !reflect.DeepEqual(config, DefaultConfig()) {
+		t.Errorf("LoadConfig() = %+v, want defaults %+v", config, DefaultConfig())
+	}
+}
+
+func TestLoadConfigMigratesLegacyFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), ConfigFileName)
+	legacy := `{"last_used_profile": "", "cached_bepinex_version": "v5.4.22", "other_profiles_cloned": true}`
+	if err := os.WriteFile(configPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if config.LastUsedProfile != "Default" || config.CachedBepInExVersion != "v5.4.22" || !config.OtherProfilesCloned {
+		t.Errorf("LoadConfig() = %+v, legacy values were not migrated", config)
+	}
+
+	saved, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(saved), `"schema_version": 2`) {
+		t.Errorf("migrated config was not saved with the current schema version:\n%s", saved)
+	}
+}
+
+func TestParseConfigValidationError(t *testing.T) {
+	tests := []struct {
+		data string
+		key  string
+	}{
+		{`{"schema_version": 2, "offline": "yes"}`, "offline"},
+		{`{"schema_version": 2, "last_used_profile": "../Other"}`, "last_used_profile"},
+		{`{"schema_version": 2, "launch_mode": "teleport"}`, "launch_mode"},
+		{`{"schema_version": 2, "proxy": "not a url"}`, "proxy"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseConfig([]byte(test.data))
+
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("ParseConfig(%s) error = %v, want a ValidationError", test.data, err)
+			continue
+		}
+		if validationErr.Key != test.key {
+			t.Errorf("ParseConfig(%s) error key = %q, want %q", test.data, validationErr.Key, test.key)
+		}
+	}
+}
+
+func TestLoadConfigKeepsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ConfigFileName)
+	newer := `{"schema_version": 99, "last_used_profile": "Main", "future_setting": true}`
+	if err := os.WriteFile(configPath, []byte(newer), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig(configPath)
+	var newerErr *NewerSchemaError
+	if !errors.As(err, &newerErr) || newerErr.Version != 99 {
+		t.Fatalf("LoadConfig() error = %v, want a NewerSchemaError for version 99", err)
+	}
+	if saved := string(mustReadFile(t, configPath)); saved != newer {
+		t.Errorf("LoadConfig() changed the config file:\n%s", saved)
+	}
+	if backups, _ := filepath.Glob(filepath.Join(dir, ConfigFileName+".corrupt-*")); len(backups) != 0 {
+		t.Errorf("LoadConfig() backed up the config as corrupted: %v", backups)
+	}
+}
+
+func TestLoadConfigRecoversCorruptFile(t *testing.T) {
+	tests := []struct {
+		data        string
+		lastProfile string
+	}{
+		{`{"schema_version": 2, "last_used_profile": "Main", "offl`, "Default"},
+		{`{"schema_version": 2, "last_used_profile": "Main", "offline": "yes"}`, "Main"},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, ConfigFileName)
+		if err := os.WriteFile(configPath, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig(%s) failed: %v", test.data, err)
+		}
+		if config.LastUsedProfile != test.lastProfile || config.Offline {
+			t.Errorf("LoadConfig(%s) = %+v, want last used profile %q", test.data, config, test.lastProfile)
+		}
+
+		backups, _ := filepath.Glob(filepath.Join(dir, ConfigFileName+".corrupt-*"))
+		if len(backups) != 1 {
+			t.Errorf("LoadConfig(%s) made %d backups, want 1", test.data, len(backups))
+		}
+		if _, err := ParseConfig(mustReadFile(t, configPath)); err != nil {
+			t.Errorf("regenerated config is invalid: %v", err)
+		}
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("LETHAL_CORE_DOWNLOAD_CONCURRENCY", "8")
+	t.Setenv("LETHAL_CORE_OFFLINE", "true")
+	t.Setenv("LETHAL_CORE_IMPORT_SOURCES", "gale, r2modman")
+	t.Setenv("LETHAL_CORE_LAUNCH_MODE", "teleport")
+	t.Setenv("LETHAL_CORE_DOWNLOAD_RETRIES", "many")
+
+	config := DefaultConfig()
+	err := ApplyEnv(config)
+	if config.DownloadConcurrency != 8 || !config.Offline || !reflect.DeepEqual(config.ImportSources, []string{"gale", "r2modman"}) {
+		t.Errorf("ApplyEnv() = %+v, overrides were not applied", config)
+	}
+	if config.LaunchMode != LaunchModeSteam || config.DownloadRetries != DefaultConfig().DownloadRetries {
+		t.Errorf("ApplyEnv() = %+v, invalid overrides were applied", config)
+	}
+
+	for _, key := range []string{"LETHAL_CORE_LAUNCH_MODE", "LETHAL_CORE_DOWNLOAD_RETRIES"} {
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("ApplyEnv() error = %v, want an error for %s", err, key)
+		}
+	}
+}
+
+func TestLoadConfigSetsActive(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(`{"schema_version": 2, "download_concurrency": 7, "community": "content-warning"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvName("download_concurrency"), "9")
+
+	if _, err := LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if active := Active(); active.Community != "content-warning" || active.DownloadConcurrency != 9 {
+		t.Errorf("Active() = %+v, want the loaded config with the environment overrides", active)
+	}
+
+	store, err := NewStore(configPath)
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	if got := store.Get().DownloadConcurrency; got != 9 {
+		t.Errorf("Store.Get() download concurrency = %d, want the override 9", got)
+	}
+	if saved := string(mustReadFile(t, configPath)); strings.Contains(saved, "9") {
+		t.Errorf("the environment override was saved:\n%s", saved)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+)
+
+// CurrentSchemaVersion is the schema version SaveConfig writes.
+const CurrentSchemaVersion = 2
+
+// legacySchemaVersion is the version of config files written before schema_version existed.
+const legacySchemaVersion = 1
+
+// NewerSchemaError is returned for config files written by a newer version of the
+// manager. Their values can't be read safely, so LoadConfig leaves such files alone.
+type NewerSchemaError struct {
+	Version int
+}
+
+func (e *NewerSchemaError) Error() string {
+	return fmt.Sprintf("config schema version %d was written by a newer version of the manager, this version supports up to %d", e.Version, CurrentSchemaVersion)
+}
+
+// migrations upgrade the raw config file one schema version at a time.
+// migrations[v] turns a version v file into a version v+1 file.
+var migrations = map[int]func(raw map[string]any) error{
+	// Version 1 files have no schema_version. InitializeConfig wrote "Default" as the
+	// last used profile, but files saved later could have it empty.
+	1: func(raw map[string]any) error {
+		if profile, _ := raw["last_used_profile"].(string); profile == "" {
+			raw["last_used_profile"] = "Default"
+		}
+		return nil
+	},
+}
+
+// schemaVersion reads the schema version of a raw config file.
+func schemaVersion(raw map[string]any) (int, error) {
+	value, ok := raw["schema_version"]
+	if !ok {
+		return legacySchemaVersion, nil
+	}
+
+	number, ok := value.(float64)
+	if !ok || number != float64(int(number)) || number < legacySchemaVersion {
+		return 0, &ValidationError{Key: "schema_version", Message: fmt.Sprintf("invalid version %v", value)}
+	}
+	if int(number) > CurrentSchemaVersion {
+		return 0, &NewerSchemaError{Version: int(number)}
+	}
+
+	return int(number), nil
+}
+
+// migrate upgrades the raw config file from version to CurrentSchemaVersion.
+func migrate(raw map[string]any, version int) error {
+	for ; version < CurrentSchemaVersion; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("no config migration from schema version %d", version)
+		}
+		if err := migration(raw); err != nil {
+			return fmt.Errorf("error migrating config from schema version %d: %w", version, err)
+		}
+	}
+
+	raw["schema_version"] = CurrentSchemaVersion
+	return nil
+}
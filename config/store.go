@@ -0,0 +1,172 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+)
+
+// Store keeps the config in memory and writes changes to the config file.
+// Update holds a cross-process lock while it reads, changes and writes the file,
+// so several frontends can share one config without losing each other's changes.
+// Every config the store loads or saves becomes the active config, see SetActive.
+type Store struct {
+	path string
+
+	mu          sync.Mutex
+	config      *Config
+	modTime     time.Time
+	size        int64
+	subscribers map[int]func(*Config)
+	nextID      int
+}
+
+// NewStore loads the config file into a new store.
+func NewStore(configPath string) (*Store, error) {
+	store := &Store{
+		path:        configPath,
+		subscribers: map[int]func(*Config){},
+	}
+
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Path returns the path of the config file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns a copy of the current config with the environment overrides applied,
+// like Active. Update changes the config without them, so they are never saved.
+func (s *Store) Get() *Config {
+	s.mu.Lock()
+	config := s.config.Clone()
+	s.mu.Unlock()
+
+	ApplyEnv(config)
+	return config
+}
+
+// Update applies update to the newest config on disk and saves it. Nothing is saved
+// if update returns an error or the result doesn't validate.
+func (s *Store) Update(update func(*Config) error) error {
+	lock, err := fileutil.LockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	config, err := loadConfig(s.path, true)
+	if err != nil {
+		return err
+	}
+	if err := update(config); err != nil {
+		return err
+	}
+	config.SchemaVersion = CurrentSchemaVersion
+	if err := Validate(config); err != nil {
+		return err
+	}
+	if err := SaveConfig(s.path, config); err != nil {
+		return err
+	}
+
+	s.set(config)
+	return nil
+}
+
+// Subscribe calls fn with a copy of the config every time it changes, through Update
+// or on disk. It returns a function that removes the subscription.
+func (s *Store) Subscribe(fn func(*Config)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	s.subscribers[id] = fn
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// Reload reads the config file again if it changed on disk, e.g. because another
+// process saved it, and notifies the subscribers when the config is different.
+func (s *Store) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	unchanged := s.config != nil && info != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size
+	s.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	lock, err := fileutil.LockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	config, err := loadConfig(s.path, true)
+	if err != nil {
+		return err
+	}
+
+	s.set(config)
+	return nil
+}
+
+// Watch polls the config file for changes made by other processes until ctx is done.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// set stores the config and the state of the file it was read from, and notifies
+// the subscribers if the config changed.
+func (s *Store) set(config *Config) {
+	s.mu.Lock()
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+		s.size = info.Size()
+	}
+	changed := s.config != nil && !reflect.DeepEqual(s.config, config)
+	s.config = config
+
+	var subscribers []func(*Config)
+	if changed {
+		for _, fn := range s.subscribers {
+			subscribers = append(subscribers, fn)
+		}
+	}
+	s.mu.Unlock()
+
+	// Subscribers are called without holding the lock, so they can use the store.
+	for _, fn := range subscribers {
+		fn(config.Clone())
+	}
+}
@@ -0,0 +1,344 @@
+package doorstop
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+)
+
+const ConfigFileName = "doorstop_config.ini"
+const ProxyDllName = "winhttp.dll"
+const DefaultTargetAssembly = `BepInEx\core\BepInEx.Preloader.dll`
+
+// Config is the Doorstop configuration shipped at the root of a BepInEx install.
+type Config struct {
+	Enabled               bool   `json:"enabled"`
+	TargetAssembly        string `json:"target_assembly"`
+	RedirectOutputLog     bool   `json:"redirect_output_log"`
+	IgnoreDisableSwitch   bool   `json:"ignore_disable_switch"`
+	DllSearchPathOverride string `json:"dll_search_path_override"`
+}
+
+// DefaultConfig returns the configuration BepInEx ships with.
+func DefaultConfig() *Config {
+	return &Config{
+		Enabled:        true,
+		TargetAssembly: DefaultTargetAssembly,
+	}
+}
+
+// configKeys maps normalized ini keys of both Doorstop 3 and 4 to their Config fields.
+var configKeys = map[string]string{
+	"enabled":               "enabled",
+	"targetassembly":        "targetAssembly",
+	"redirectoutputlog":     "redirectOutputLog",
+	"ignoredisableswitch":   "ignoreDisableSwitch",
+	"dllsearchpathoverride": "dllSearchPathOverride",
+}
+
+// normalizeKey lowercases the key and strips underscores, so that
+// "target_assembly" and "targetAssembly" are treated the same.
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(key), "_", ""))
+}
+
+// ReadConfig reads the Doorstop configuration of the BepInEx install in profilePath.
+func ReadConfig(profilePath string) (*Config, error) {
+	file, err := os.ReadFile(filepath.Join(profilePath, ConfigFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseConfig(file)
+}
+
+// ParseConfig parses the contents of a doorstop_config.ini file.
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		key, value, ok := splitLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		field, known := configKeys[normalizeKey(key)]
+		if !known {
+			continue
+		}
+
+		var err error
+		switch field {
+		case "enabled":
+			config.Enabled, err = strconv.ParseBool(value)
+		case "targetAssembly":
+			config.TargetAssembly = value
+		case "redirectOutputLog":
+			config.RedirectOutputLog, err = strconv.ParseBool(value)
+		case "ignoreDisableSwitch":
+			config.IgnoreDisableSwitch, err = strconv.ParseBool(value)
+		case "dllSearchPathOverride":
+			config.DllSearchPathOverride = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s on line %d: %w", key, lineNumber, err)
+		}
+	}
+
+	return config, scanner.Err()
+}
+
+// splitLine splits an ini line into key and value. Comments and section headers are skipped.
+func splitLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "[") {
+		return "", "", false
+	}
+
+	key, value, found := strings.Cut(line, "=")
+	if !found {
+		return "", "", false
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(value), true
+}
+
+// WriteConfig writes the Doorstop configuration into profilePath.
+// Keys already present in the file are updated in place, so comments and the
+// Doorstop 3/4 key style of the shipped file are kept. Missing keys are added to
+// the section Doorstop reads them from.
+func WriteConfig(profilePath string, config *Config) error {
+	configPath := filepath.Join(profilePath, ConfigFileName)
+
+	existing, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		existing = []byte(defaultConfigTemplate)
+	} else if err != nil {
+		return err
+	}
+
+	values := map[string]string{
+		"enabled":               strconv.FormatBool(config.Enabled),
+		"targetAssembly":        config.TargetAssembly,
+		"redirectOutputLog":     strconv.FormatBool(config.RedirectOutputLog),
+		"ignoreDisableSwitch":   strconv.FormatBool(config.IgnoreDisableSwitch),
+		"dllSearchPathOverride": config.DllSearchPathOverride,
+	}
+
+	newline := "\n"
+	if bytes.Contains(existing, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+
+	text := strings.ReplaceAll(string(existing), "\r\n", "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+
+	// sectionEnds is the index of the last key or header line of every section.
+	written := map[string]bool{}
+	sectionEnds := map[string]int{}
+	section := ""
+	for i, line := range lines {
+		if name, ok := sectionName(line); ok {
+			section = name
+			sectionEnds[section] = i
+			continue
+		}
+		key, _, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+		sectionEnds[section] = i
+		if field, known := configKeys[normalizeKey(key)]; known {
+			lines[i] = key + "=" + values[field]
+			written[field] = true
+		}
+	}
+
+	// Add the keys the existing file did not have, in the style of the file.
+	layout := doorstop3Layout
+	if _, ok := sectionEnds["general"]; ok {
+		layout = doorstop4Layout
+	}
+	inserts := map[int][]string{}
+	var appended []string
+	var appendedSections []string
+	for _, field := range configFields {
+		if written[field] {
+			continue
+		}
+		key := layout[field]
+		entry := key.name + "=" + values[field]
+		if end, ok := sectionEnds[strings.ToLower(key.section)]; ok {
+			inserts[end] = append(inserts[end], entry)
+			continue
+		}
+		if !containsString(appendedSections, key.section) {
+			appendedSections = append(appendedSections, key.section)
+			if len(lines) > 0 || len(appended) > 0 {
+				appended = append(appended, "")
+			}
+			appended = append(appended, "["+key.section+"]")
+		}
+		appended = append(appended, entry)
+	}
+
+	var out strings.Builder
+	for i, line := range lines {
+		out.WriteString(line + newline)
+		for _, entry := range inserts[i] {
+			out.WriteString(entry + newline)
+		}
+	}
+	for _, line := range appended {
+		out.WriteString(line + newline)
+	}
+
+	return fileutil.WriteFile(configPath, []byte(out.String()), 0644)
+}
+
+// configFields are the Config fields in the order Doorstop lists them.
+var configFields = []string{"enabled", "targetAssembly", "redirectOutputLog", "ignoreDisableSwitch", "dllSearchPathOverride"}
+
+// layoutKey is where a Doorstop version expects a key.
+type layoutKey struct {
+	section string
+	name    string
+}
+
+// doorstop3Layout keeps every key in [UnityDoorstop].
+var doorstop3Layout = map[string]layoutKey{
+	"enabled":               {"UnityDoorstop", "enabled"},
+	"targetAssembly":        {"UnityDoorstop", "targetAssembly"},
+	"redirectOutputLog":     {"UnityDoorstop", "redirectOutputLog"},
+	"ignoreDisableSwitch":   {"UnityDoorstop", "ignoreDisableSwitch"},
+	"dllSearchPathOverride": {"UnityDoorstop", "dllSearchPathOverride"},
+}
+
+// doorstop4Layout splits the keys into [General] and [UnityMono].
+var doorstop4Layout = map[string]layoutKey{
+	"enabled":               {"General", "enabled"},
+	"targetAssembly":        {"General", "target_assembly"},
+	"redirectOutputLog":     {"General", "redirect_output_log"},
+	"ignoreDisableSwitch":   {"General", "ignore_disable_switch"},
+	"dllSearchPathOverride": {"UnityMono", "dll_search_path_override"},
+}
+
+// sectionName returns the lowercased name of an ini section header line.
+func sectionName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimSpace(line[1 : len(line)-1])), true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveTargetAssembly returns the absolute path of the target assembly.
+// Relative targets are resolved against profilePath.
+func ResolveTargetAssembly(profilePath string, config *Config) string {
+	target := filepath.FromSlash(strings.ReplaceAll(config.TargetAssembly, `\`, "/"))
+	if filepath.IsAbs(target) || strings.Contains(config.TargetAssembly, ":") {
+		return config.TargetAssembly
+	}
+	return filepath.Join(profilePath, target)
+}
+
+// Problem describes a missing or mismatched Doorstop file in a profile.
+type Problem struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+func (p Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+// Validate checks the Doorstop files of the profile in profilePath.
+// If gameDir is not empty, the proxy dll installed next to the game executable
+// is also compared against the one shipped with the profile.
+func Validate(profilePath, gameDir string) ([]Problem, error) {
+	var problems []Problem
+
+	proxyPath := filepath.Join(profilePath, ProxyDllName)
+	if _, err := os.Stat(proxyPath); os.IsNotExist(err) {
+		problems = append(problems, Problem{File: ProxyDllName, Message: "file is missing"})
+	} else if err != nil {
+		return nil, err
+	} else if gameDir != "" {
+		gameProxyPath := filepath.Join(gameDir, ProxyDllName)
+		if _, err := os.Stat(gameProxyPath); os.IsNotExist(err) {
+			problems = append(problems, Problem{File: gameProxyPath, Message: "Doorstop proxy is not installed in the game directory"})
+		} else if same, err := sameContents(proxyPath, gameProxyPath); err != nil {
+			return nil, err
+		} else if !same {
+			problems = append(problems, Problem{File: gameProxyPath, Message: "Doorstop proxy does not match the profile's version"})
+		}
+	}
+
+	config, err := ReadConfig(profilePath)
+	if os.IsNotExist(err) {
+		return append(problems, Problem{File: ConfigFileName, Message: "file is missing"}), nil
+	} else if err != nil {
+		return append(problems, Problem{File: ConfigFileName, Message: err.Error()}), nil
+	}
+
+	if !config.Enabled {
+		problems = append(problems, Problem{File: ConfigFileName, Message: "Doorstop is disabled"})
+	}
+
+	if config.TargetAssembly == "" {
+		problems = append(problems, Problem{File: ConfigFileName, Message: "target assembly is not set"})
+	} else if _, err := os.Stat(ResolveTargetAssembly(profilePath, config)); os.IsNotExist(err) {
+		problems = append(problems, Problem{File: ConfigFileName, Message: fmt.Sprintf("target assembly %s does not exist", config.TargetAssembly)})
+	}
+
+	return problems, nil
+}
+
+// sameContents reports whether both files have the same sha256 hash.
+func sameContents(pathA, pathB string) (bool, error) {
+	hashA, err := fileutil.HashFile(pathA)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := fileutil.HashFile(pathB)
+	if err != nil {
+		return false, err
+	}
+	return hashA == hashB, nil
+}
+
+const defaultConfigTemplate = `[UnityDoorstop]
+# Specifies whether assembly executing is enabled
+enabled=true
+# Specifies the path (absolute, or relative to the game's exe) to the DLL/EXE that should be executed by Doorstop
+targetAssembly=BepInEx\core\BepInEx.Preloader.dll
+# Specifies whether Unity's output log should be redirected to <current folder>\output_log.txt
+redirectOutputLog=false
+# If enabled, DOORSTOP_DISABLE env var value is ignored
+# USE THIS ONLY WHEN ASKED TO OR YOU KNOW WHAT THIS MEANS
+ignoreDisableSwitch=false
+# Overrides default Mono DLL search path
+# Sometimes it is needed to instruct Mono to seek its assemblies from a different path
+# (e.g. mscorlib is stripped in original game)
+# This option causes Mono to seek mscorlib and core libraries from a different folder before Managed
+# Original Managed folder is added as a secondary folder in the search path
+dllSearchPathOverride=
+`
@@ -0,0 +1,215 @@
+package doorstop
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Config
+	}{
+		{
+			name: "doorstop 3",
+			data: "[UnityDoorstop]\r\n# Specifies whether assembly executing is enabled\r\nenabled=true\r\ntargetAssembly=BepInEx\\core\\BepInEx.Preloader.dll\r\nredirectOutputLog=false\r\nignoreDisableSwitch=true\r\ndllSearchPathOverride=\r\n",
+			want: Config{Enabled: true, TargetAssembly: `BepInEx\core\BepInEx.Preloader.dll`, IgnoreDisableSwitch: true},
+		},
+		{
+			name: "doorstop 4",
+			data: "[General]\nenabled = true\ntarget_assembly = BepInEx\\core\\BepInEx.Preloader.dll\nredirect_output_log = true\n; comment = ignored\n\n[UnityMono]\ndll_search_path_override = Unstripped\ndebug_enabled = false\n",
+			want: Config{Enabled: true, TargetAssembly: `BepInEx\core\BepInEx.Preloader.dll`, RedirectOutputLog: true, DllSearchPathOverride: "Unstripped"},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: Config{},
+		},
+	}
+
+	for _, test := range tests {
+		config, err := ParseConfig([]byte(test.data))
+		if err != nil {
+			t.Fatalf("%s: ParseConfig() failed: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(*config, test.want) {
+			t.Errorf("%s: ParseConfig() = %+v, want %+v", test.name, *config, test.want)
+		}
+	}
+}
+
+func TestParseConfigInvalidValue(t *testing.T) {
+	_, err := ParseConfig([]byte("[General]\nenabled = yes please\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ParseConfig() error = %v, want an error for line 2", err)
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		config   Config
+		want     string
+	}{
+		{
+			name:     "doorstop 3 updated in place keeps CRLF and comments",
+			existing: "[UnityDoorstop]\r\n# comment\r\nenabled=true\r\ntargetAssembly=BepInEx\\core\\BepInEx.Preloader.dll\r\n",
+			config:   Config{TargetAssembly: `BepInEx\core\BepInEx.Preloader.dll`},
+			want:     "[UnityDoorstop]\r\n# comment\r\nenabled=false\r\ntargetAssembly=BepInEx\\core\\BepInEx.Preloader.dll\r\nredirectOutputLog=false\r\nignoreDisableSwitch=false\r\ndllSearchPathOverride=\r\n",
+		},
+		{
+			name:     "doorstop 4 missing keys go to [General] and a new [UnityMono]",
+			existing: "[General]\nenabled = true\ntarget_assembly = BepInEx\\core\\BepInEx.Preloader.dll\n",
+			config:   Config{TargetAssembly: "Custom.dll", RedirectOutputLog: true, DllSearchPathOverride: "Unstripped"},
+			want:     "[General]\nenabled=false\ntarget_assembly=Custom.dll\nredirect_output_log=true\nignore_disable_switch=false\n\n[UnityMono]\ndll_search_path_override=Unstripped\n",
+		},
+		{
+			name:     "doorstop 4 keys after other sections",
+			existing: "[General]\nenabled=true\n\n[UnityMono]\ndebug_enabled=false\n",
+			config:   Config{Enabled: true, TargetAssembly: "Custom.dll"},
+			want:     "[General]\nenabled=true\ntarget_assembly=Custom.dll\nredirect_output_log=false\nignore_disable_switch=false\n\n[UnityMono]\ndebug_enabled=false\ndll_search_path_override=\n",
+		},
+		{
+			name:     "empty file gets a [UnityDoorstop] section",
+			existing: "",
+			config:   Config{Enabled: true, TargetAssembly: "Custom.dll"},
+			want:     "[UnityDoorstop]\nenabled=true\ntargetAssembly=Custom.dll\nredirectOutputLog=false\nignoreDisableSwitch=false\ndllSearchPathOverride=\n",
+		},
+	}
+
+	for _, test := range tests {
+		profilePath := t.TempDir()
+		configPath := filepath.Join(profilePath, ConfigFileName)
+		if err := os.WriteFile(configPath, []byte(test.existing), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := WriteConfig(profilePath, &test.config); err != nil {
+			t.Fatalf("%s: WriteConfig() failed: %v", test.name, err)
+		}
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("%s: WriteConfig() wrote:\n%q\nwant:\n%q", test.name, data, test.want)
+		}
+
+		config, err := ReadConfig(profilePath)
+		if err != nil {
+			t.Fatalf("%s: ReadConfig() failed: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(*config, test.config) {
+			t.Errorf("%s: ReadConfig() = %+v, want the written %+v", test.name, *config, test.config)
+		}
+	}
+}
+
+func TestWriteConfigWithoutFile(t *testing.T) {
+	profilePath := t.TempDir()
+	config := DefaultConfig()
+	config.Enabled = false
+
+	if err := WriteConfig(profilePath, config); err != nil {
+		t.Fatalf("WriteConfig() failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(profilePath, ConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(defaultConfigTemplate, "enabled=true", "enabled=false", 1)
+	if string(data) != want {
+		t.Errorf("WriteConfig() wrote:\n%s\nwant the default template with enabled=false:\n%s", data, want)
+	}
+}
+
+func TestResolveTargetAssembly(t *testing.T) {
+	profilePath := t.TempDir()
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{`BepInEx\core\BepInEx.Preloader.dll`, filepath.Join(profilePath, "BepInEx", "core", "BepInEx.Preloader.dll")},
+		{"BepInEx/core/BepInEx.Preloader.dll", filepath.Join(profilePath, "BepInEx", "core", "BepInEx.Preloader.dll")},
+		{`C:\Games\BepInEx\core\BepInEx.Preloader.dll`, `C:\Games\BepInEx\core\BepInEx.Preloader.dll`},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			target string
+			want   string
+		}{"/opt/BepInEx/core/BepInEx.Preloader.dll", "/opt/BepInEx/core/BepInEx.Preloader.dll"})
+	}
+
+	for _, test := range tests {
+		if got := ResolveTargetAssembly(profilePath, &Config{TargetAssembly: test.target}); got != test.want {
+			t.Errorf("ResolveTargetAssembly(%q) = %q, want %q", test.target, got, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	profilePath := t.TempDir()
+	gameDir := t.TempDir()
+
+	problems, err := Validate(profilePath, gameDir)
+	if err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if files := problemFiles(problems); !reflect.DeepEqual(files, []string{ProxyDllName, ConfigFileName}) {
+		t.Errorf("Validate() of an empty profile reported %v, want the missing proxy and config", problems)
+	}
+
+	writeFile(t, filepath.Join(profilePath, ProxyDllName), "proxy 4.0")
+	writeFile(t, filepath.Join(gameDir, ProxyDllName), "proxy 3.4")
+	writeFile(t, filepath.Join(profilePath, ConfigFileName), "[General]\nenabled=false\ntarget_assembly=BepInEx\\core\\BepInEx.Preloader.dll\n")
+
+	problems, err = Validate(profilePath, gameDir)
+	if err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	want := []string{"Doorstop proxy does not match the profile's version", "Doorstop is disabled", `target assembly BepInEx\core\BepInEx.Preloader.dll does not exist`}
+	if messages := problemMessages(problems); !reflect.DeepEqual(messages, want) {
+		t.Errorf("Validate() = %q, want %q", messages, want)
+	}
+
+	writeFile(t, filepath.Join(gameDir, ProxyDllName), "proxy 4.0")
+	writeFile(t, filepath.Join(profilePath, ConfigFileName), "[General]\nenabled=true\ntarget_assembly=BepInEx\\core\\BepInEx.Preloader.dll\n")
+	writeFile(t, filepath.Join(profilePath, "BepInEx", "core", "BepInEx.Preloader.dll"), "")
+
+	problems, err = Validate(profilePath, gameDir)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("Validate() of a complete profile = %v, %v, want no problems", problems, err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func problemFiles(problems []Problem) []string {
+	var files []string
+	for _, problem := range problems {
+		files = append(files, problem.File)
+	}
+	return files
+}
+
+func problemMessages(problems []Problem) []string {
+	var messages []string
+	for _, problem := range problems {
+		messages = append(messages, problem.Message)
+	}
+	return messages
+}
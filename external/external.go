@@ -0,0 +1,117 @@
+// Package external finds and reads the profiles of other mod managers:
+// r2modman, Thunderstore Mod Manager and Gale.
+package external
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// Manager is another mod manager profiles can be imported from.
+type Manager struct {
+	// Name identifies the manager in the config's import sources.
+	Name        string
+	DisplayName string
+	// ProfilesDirs returns the directories the manager may keep its profiles in
+	// on the current platform.
+	ProfilesDirs func() []string
+}
+
+// Profile is a profile of another mod manager.
+type Profile struct {
+	Manager string `json:"manager"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+}
+
+// ErrManagerNotFound is returned when a manager has no profiles directory on this machine.
+var ErrManagerNotFound = errors.New("mod manager is not installed")
+
+// Managers are the supported mod managers.
+var Managers = []Manager{
+	{
+		Name:        "r2modman",
+		DisplayName: "r2modman",
+		ProfilesDirs: func() []string {
+			return configDirs(filepath.Join("r2modmanPlus-local", "LethalCompany", "profiles"))
+		},
+	},
+	{
+		Name:        "thunderstore",
+		DisplayName: "Thunderstore Mod Manager",
+		ProfilesDirs: func() []string {
+			return configDirs(filepath.Join("Thunderstore Mod Manager", "DataFolder", "LethalCompany", "profiles"))
+		},
+	},
+	{
+		Name:        "gale",
+		DisplayName: "Gale",
+		ProfilesDirs: func() []string {
+			return dataDirs(filepath.Join("com.kesomannen.gale", "lethal-company", "profiles"))
+		},
+	},
+}
+
+// FindManager returns the supported manager with the given name.
+func FindManager(name string) (Manager, bool) {
+	for _, manager := range Managers {
+		if manager.Name == name {
+			return manager, true
+		}
+	}
+	return Manager{}, false
+}
+
+// ListProfiles lists the profiles of the manager, sorted by name.
+// It returns ErrManagerNotFound when the manager has no profiles directory.
+func ListProfiles(manager Manager) ([]Profile, error) {
+	for _, dir := range manager.ProfilesDirs() {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var profiles []Profile
+		for _, entry := range entries {
+			if entry.IsDir() {
+				profiles = append(profiles, Profile{Manager: manager.Name, Name: entry.Name(), Path: filepath.Join(dir, entry.Name())})
+			}
+		}
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+		return profiles, nil
+	}
+
+	return nil, ErrManagerNotFound
+}
+
+// configDirs returns rel inside the user config directory: %AppData% on windows,
+// $XDG_CONFIG_HOME or ~/.config on linux.
+func configDirs(rel string) []string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(dir, rel)}
+}
+
+// dataDirs returns rel inside the user data directory: %AppData% on windows,
+// $XDG_DATA_HOME or ~/.local/share on linux.
+func dataDirs(rel string) []string {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return configDirs(rel)
+	}
+
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return []string{filepath.Join(dir, rel)}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(home, ".local", "share", rel)}
+}
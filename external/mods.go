@@ -0,0 +1,213 @@
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+	"gopkg.in/yaml.v3"
+)
+
+// ModsFileName is the list of installed mods r2modman-compatible managers keep in every profile.
+const ModsFileName = "mods.yml"
+
+// disabledSuffix is appended to the files of a disabled mod.
+const disabledSuffix = ".old"
+
+// Mod is a package installed in a profile of another mod manager.
+type Mod struct {
+	Author  string `json:"author"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Enabled bool   `json:"enabled"`
+}
+
+// FullName returns the Author-Name the manager names the plugin directory of the mod after.
+func (m Mod) FullName() string {
+	return m.Author + "-" + m.Name
+}
+
+// modsFileEntry is an entry of mods.yml. Inline keeps the keys this package doesn't
+// use, so they survive rewriting the file.
+type modsFileEntry struct {
+	Name          string          `yaml:"name"`
+	AuthorName    string          `yaml:"authorName"`
+	VersionNumber modsFileVersion `yaml:"versionNumber"`
+	Enabled       bool            `yaml:"enabled"`
+	Inline        map[string]any  `yaml:",inline"`
+}
+
+type modsFileVersion struct {
+	Major int `yaml:"major"`
+	Minor int `yaml:"minor"`
+	Patch int `yaml:"patch"`
+}
+
+func (v modsFileVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// ReadMods returns the mods of the profile from its mods.yml. Profiles without one,
+// e.g. from managers that don't write it, are read from their plugin directories.
+func ReadMods(profilePath string) ([]Mod, error) {
+	entries, err := readModsFile(profilePath)
+	if os.IsNotExist(err) {
+		return scanPlugins(profilePath)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var mods []Mod
+	for _, entry := range entries {
+		author, name, ok := strings.Cut(entry.Name, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid package name %q in %s", entry.Name, ModsFileName)
+		}
+		if entry.AuthorName != "" {
+			author = entry.AuthorName
+			name = strings.TrimPrefix(entry.Name, author+"-")
+		}
+		mods = append(mods, Mod{Author: author, Name: name, Version: entry.VersionNumber.String(), Enabled: entry.Enabled})
+	}
+
+	return mods, nil
+}
+
+// WriteMods writes mods as the mods.yml of the profile. Entries of packages that were
+// already listed keep the keys the other managers store in them.
+func WriteMods(profilePath string, mods []Mod) error {
+	existing, err := readModsFile(profilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	byName := map[string]modsFileEntry{}
+	for _, entry := range existing {
+		byName[entry.Name] = entry
+	}
+
+	entries := make([]modsFileEntry, 0, len(mods))
+	for _, mod := range mods {
+		entry, ok := byName[mod.FullName()]
+		if !ok {
+			entry = modsFileEntry{Inline: map[string]any{
+				"manifestVersion": 1,
+				"displayName":     mod.Name,
+			}}
+		}
+		entry.Name = mod.FullName()
+		entry.AuthorName = mod.Author
+		entry.Enabled = mod.Enabled
+		if entry.VersionNumber, err = parseModsFileVersion(mod.Version); err != nil {
+			return fmt.Errorf("%s: %w", mod.FullName(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(filepath.Join(profilePath, ModsFileName), data, 0644)
+}
+
+// parseModsFileVersion parses a major.minor.patch version number.
+func parseModsFileVersion(version string) (modsFileVersion, error) {
+	var v modsFileVersion
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &v.Major, &v.Minor, &v.Patch); err != nil {
+		return v, fmt.Errorf("invalid version number %q", version)
+	}
+	return v, nil
+}
+
+func readModsFile(profilePath string) ([]modsFileEntry, error) {
+	data, err := os.ReadFile(filepath.Join(profilePath, ModsFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []modsFileEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", ModsFileName, err)
+	}
+	return entries, nil
+}
+
+// scanPlugins reads the mods from the manifest.json in every plugin directory.
+// A mod is disabled when all of its files are. Plugin directories without a manifest
+// or without a version in it are not reported, they can't be named Author-Name-Version.
+func scanPlugins(profilePath string) ([]Mod, error) {
+	pluginsDir := filepath.Join(profilePath, "BepInEx", "plugins")
+	entries, err := os.ReadDir(pluginsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var mods []Mod
+	for _, entry := range entries {
+		author, name, ok := strings.Cut(entry.Name(), "-")
+		if !entry.IsDir() || !ok {
+			continue
+		}
+
+		manifestFile, err := os.ReadFile(filepath.Join(pluginsDir, entry.Name(), "manifest.json"))
+		if err != nil {
+			continue
+		}
+		var manifest struct {
+			Version string `json:"version_number"`
+		}
+		if err := json.Unmarshal(trimBOM(manifestFile), &manifest); err != nil {
+			return nil, fmt.Errorf("error reading manifest of %s: %w", entry.Name(), err)
+		}
+		if manifest.Version == "" {
+			continue
+		}
+
+		enabled, err := hasEnabledFiles(filepath.Join(pluginsDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, Mod{Author: author, Name: name, Version: manifest.Version, Enabled: enabled})
+	}
+
+	return mods, nil
+}
+
+// hasEnabledFiles reports whether the mod directory has files that are not disabled.
+// The package metadata next to the manifest is never disabled and doesn't count.
+func hasEnabledFiles(modPath string) (bool, error) {
+	enabled := false
+	err := filepath.WalkDir(modPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, disabledSuffix) {
+			return nil
+		}
+		if filepath.Dir(path) == modPath && packageMetadataFiles[strings.ToLower(entry.Name())] {
+			return nil
+		}
+		enabled = true
+		return filepath.SkipAll
+	})
+	return enabled, err
+}
+
+// packageMetadataFiles are the files of a Thunderstore package that aren't part of the mod.
+var packageMetadataFiles = map[string]bool{
+	"manifest.json": true,
+	"icon.png":      true,
+	"readme.md":     true,
+	"changelog.md":  true,
+}
+
+func trimBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+}
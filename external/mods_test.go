@@ -0,0 +1,111 @@
+package external
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadMods(t *testing.T) {
+	profilePath := t.TempDir()
+	modsFile := `- manifestVersion: 1
+  name: BepInEx-BepInExPack
+  authorName: BepInEx
+  versionNumber:
+    major: 5
+    minor: 4
+    patch: 2100
+  enabled: true
+- manifestVersion: 1
+  name: x753-Mimics
+  authorName: x753
+  versionNumber: {major: 2, minor: 3, patch: 0}
+  enabled: false
+`
+	if err := os.WriteFile(filepath.Join(profilePath, ModsFileName), []byte(modsFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mods, err := ReadMods(profilePath)
+	if err != nil {
+		t.Fatalf("ReadMods() failed: %v", err)
+	}
+
+	want := []Mod{
+		{Author: "BepInEx", Name: "BepInExPack", Version: "5.4.2100", Enabled: true},
+		{Author: "x753", Name: "Mimics", Version: "2.3.0", Enabled: false},
+	}
+	if !reflect.DeepEqual(mods, want) {
+		t.Errorf("ReadMods() = %+v, want %+v", mods, want)
+	}
+}
+
+func TestReadModsWithoutModsFile(t *testing.T) {
+	profilePath := t.TempDir()
+	pluginsDir := filepath.Join(profilePath, "BepInEx", "plugins")
+	files := map[string]string{
+		"x753-Mimics/manifest.json":  "\xEF\xBB\xBF" + `{"name": "Mimics", "version_number": "2.3.0"}`,
+		"x753-Mimics/Mimics.dll.old": "",
+		// Without a version the mod is left out.
+		"x753-Broken/manifest.json": `{"name": "Broken"}`,
+		"x753-Broken/Broken.dll":    "",
+	}
+	for name, content := range files {
+		path := filepath.Join(pluginsDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mods, err := ReadMods(profilePath)
+	if err != nil {
+		t.Fatalf("ReadMods() failed: %v", err)
+	}
+
+	want := []Mod{{Author: "x753", Name: "Mimics", Version: "2.3.0", Enabled: false}}
+	if !reflect.DeepEqual(mods, want) {
+		t.Errorf("ReadMods() = %+v, want %+v", mods, want)
+	}
+}
+
+func TestWriteModsKeepsUnknownKeys(t *testing.T) {
+	profilePath := t.TempDir()
+	modsFile := `- manifestVersion: 1
+  name: x753-Mimics
+  authorName: x753
+  icon: /path/to/icon.png
+  versionNumber: {major: 2, minor: 3, patch: 0}
+  enabled: true
+`
+	if err := os.WriteFile(filepath.Join(profilePath, ModsFileName), []byte(modsFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mods := []Mod{
+		{Author: "x753", Name: "Mimics", Version: "2.4.0", Enabled: false},
+		{Author: "notnotnotswipez", Name: "MoreCompany", Version: "1.7.2", Enabled: true},
+	}
+	if err := WriteMods(profilePath, mods); err != nil {
+		t.Fatalf("WriteMods() failed: %v", err)
+	}
+
+	read, err := ReadMods(profilePath)
+	if err != nil {
+		t.Fatalf("ReadMods() failed: %v", err)
+	}
+	if !reflect.DeepEqual(read, mods) {
+		t.Errorf("ReadMods() = %+v, want %+v", read, mods)
+	}
+
+	entries, err := readModsFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Inline["icon"] != "/path/to/icon.png" {
+		t.Errorf("WriteMods() dropped the icon of an existing entry: %+v", entries[0])
+	}
+}
@@ -10,11 +10,23 @@ import (
 const defaultBasePath = "Lethal Foundation/Lethal Mod Manager"
 const DefaultCacheDir = "Caches"
 
-// getDefaultPath gets the full default path under %AppData%.
+// ProfilesDirName is the directory inside LethalCompany that holds the profiles.
+const ProfilesDirName = "Profiles"
+
+// getDefaultPath gets the full default path under %AppData%, or the directory
+// set in the LETHAL_CORE_BASE_PATH environment variable.
 var GetDefaultPath = func() string {
+	if basePath := os.Getenv(config.BasePathEnv); basePath != "" {
+		return basePath
+	}
 	return filepath.Join(os.Getenv("APPDATA"), defaultBasePath)
 }
 
+// ProfilePath returns the directory of the profile under the default path.
+func ProfilePath(profileName string) string {
+	return filepath.Join(GetDefaultPath(), "LethalCompany", ProfilesDirName, profileName)
+}
+
 // InitializeStructure sets up the required directory structure in the default path.
 func InitializeStructure() error {
 	basePath := GetDefaultPath()
@@ -30,10 +42,12 @@ func InitializeStructure() error {
 		}
 	}
 
-	// Initialize the configuration file.
-	configPath := filepath.Join(basePath, config.ConfigFileName)
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		config.InitializeConfig(basePath)
+	// Initialize the configuration file and make its settings the active ones.
+	if err := config.InitializeConfig(basePath); err != nil {
+		return err
+	}
+	if _, err := config.LoadConfig(filepath.Join(basePath, config.ConfigFileName)); err != nil {
+		return err
 	}
 
 	return nil
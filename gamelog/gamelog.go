@@ -0,0 +1,216 @@
+package gamelog
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const LogFileName = "LogOutput.log"
+
+type Level string
+
+const (
+	LevelFatal   Level = "Fatal"
+	LevelError   Level = "Error"
+	LevelWarning Level = "Warning"
+	LevelMessage Level = "Message"
+	LevelInfo    Level = "Info"
+	LevelDebug   Level = "Debug"
+)
+
+type FailureKind string
+
+const (
+	MissingDependency   FailureKind = "missing-dependency"
+	PluginLoadException FailureKind = "plugin-load-exception"
+	IncompatibleBepInEx FailureKind = "incompatible-bepinex"
+	IncompatiblePlugin  FailureKind = "incompatible-plugin"
+	DuplicateGUID       FailureKind = "duplicate-guid"
+	UnhandledException  FailureKind = "unhandled-exception"
+)
+
+// Entry is a single parsed line (plus continuation lines) of LogOutput.log.
+type Entry struct {
+	Level   Level  `json:"level"`
+	Source  string `json:"source"`
+	Message string `json:"message"`
+	// Timestamp is taken from the line when BepInEx writes one, otherwise it is
+	// the time the entry was read (tailing) or zero (parsing a whole file).
+	Timestamp time.Time `json:"timestamp"`
+	Line      int       `json:"line"`
+}
+
+// Failure is a known failure pattern found in the log.
+type Failure struct {
+	Kind FailureKind `json:"kind"`
+	// Plugin is the "Name Version" of the plugin the failure is about, if known.
+	Plugin string `json:"plugin"`
+	Detail string `json:"detail"`
+	Entry  Entry  `json:"entry"`
+}
+
+var (
+	headerPattern    = regexp.MustCompile(`^(?:\[(\d{4}-\d{2}-\d{2}[ T])?(\d{2}:\d{2}:\d{2}(?:\.\d+)?)\]\s*)?\[(Fatal|Error|Warning|Message|Info|Debug)\s*:\s*([^\]]*?)\s*\]\s?(.*)$`)
+	loadingPattern   = regexp.MustCompile(`^Loading \[(.+)\]$`)
+	missingPattern   = regexp.MustCompile(`^Could not load \[(.+?)\] because it has missing dependencies: (.*)$`)
+	incompatPattern  = regexp.MustCompile(`^Could not load \[(.+?)\] because it is incompatible with: (.*)$`)
+	errorLoadPattern = regexp.MustCompile(`^Error loading \[(.+?)\]\s*:?\s*(.*)$`)
+	wrongBepPattern  = regexp.MustCompile(`^Plugin \[(.+?)\] targets a wrong version of BepInEx \((.+?)\)`)
+	skippingPattern  = regexp.MustCompile(`^Skipping \[(.+?)\] because (.*)$`)
+)
+
+// Parser turns log lines into entries. Lines without a "[Level: Source]" header
+// are appended to the message of the previous entry, as BepInEx does for stack traces.
+type Parser struct {
+	pending *Entry
+	line    int
+}
+
+// Feed parses the next line. It returns the previous entry once it is complete.
+func (p *Parser) Feed(line string, readAt time.Time) *Entry {
+	p.line++
+	line = strings.TrimRight(line, "\r")
+
+	match := headerPattern.FindStringSubmatch(line)
+	if match == nil {
+		if p.pending != nil {
+			p.pending.Message += "\n" + line
+		}
+		return nil
+	}
+
+	entry := &Entry{
+		Level:     Level(match[3]),
+		Source:    match[4],
+		Message:   match[5],
+		Timestamp: readAt,
+		Line:      p.line,
+	}
+	if match[2] != "" {
+		if timestamp, err := parseTimestamp(match[1], match[2], readAt); err == nil {
+			entry.Timestamp = timestamp
+		}
+	}
+
+	complete := p.pending
+	p.pending = entry
+	return complete
+}
+
+// Flush returns the entry that is still waiting for continuation lines.
+func (p *Parser) Flush() *Entry {
+	complete := p.pending
+	p.pending = nil
+	return complete
+}
+
+// parseTimestamp parses a "[date time]" or "[time]" prefix. A time without a date
+// is placed on the day of reference.
+func parseTimestamp(date, clock string, reference time.Time) (time.Time, error) {
+	if date != "" {
+		return time.ParseInLocation("2006-01-02 15:04:05.999999999", strings.TrimSpace(date)+" "+clock, time.Local)
+	}
+
+	parsed, err := time.ParseInLocation("15:04:05.999999999", clock, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if reference.IsZero() {
+		return parsed, nil
+	}
+	year, month, day := reference.Date()
+	return time.Date(year, month, day, parsed.Hour(), parsed.Minute(), parsed.Second(), parsed.Nanosecond(), time.Local), nil
+}
+
+// Parse reads a whole log into entries.
+func Parse(r io.Reader) ([]Entry, error) {
+	var parser Parser
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if entry := parser.Feed(scanner.Text(), time.Time{}); entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	if entry := parser.Flush(); entry != nil {
+		entries = append(entries, *entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// ParseFile reads the log file at logPath into entries.
+func ParseFile(logPath string) ([]Entry, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// DetectFailure checks the entry against the known failure patterns.
+func DetectFailure(entry Entry) *Failure {
+	message := firstLine(entry.Message)
+
+	if match := missingPattern.FindStringSubmatch(message); match != nil {
+		return &Failure{Kind: MissingDependency, Plugin: match[1], Detail: match[2], Entry: entry}
+	}
+	if match := incompatPattern.FindStringSubmatch(message); match != nil {
+		return &Failure{Kind: IncompatiblePlugin, Plugin: match[1], Detail: match[2], Entry: entry}
+	}
+	if match := wrongBepPattern.FindStringSubmatch(message); match != nil {
+		return &Failure{Kind: IncompatibleBepInEx, Plugin: match[1], Detail: match[2], Entry: entry}
+	}
+	if match := errorLoadPattern.FindStringSubmatch(message); match != nil && isProblem(entry.Level) {
+		_, stackTrace, _ := strings.Cut(entry.Message, "\n")
+		return &Failure{Kind: PluginLoadException, Plugin: match[1], Detail: strings.TrimSpace(match[2] + "\n" + stackTrace), Entry: entry}
+	}
+	if match := skippingPattern.FindStringSubmatch(message); match != nil {
+		reason := strings.ToLower(match[2])
+		if strings.Contains(reason, "guid") || strings.Contains(reason, "newer version") || strings.Contains(reason, "already") {
+			return &Failure{Kind: DuplicateGUID, Plugin: match[1], Detail: match[2], Entry: entry}
+		}
+	}
+	if isProblem(entry.Level) && strings.Contains(entry.Message, "Exception") {
+		return &Failure{Kind: UnhandledException, Detail: message, Entry: entry}
+	}
+
+	return nil
+}
+
+// DetectFailures returns every known failure found in the entries.
+func DetectFailures(entries []Entry) []Failure {
+	var failures []Failure
+	for _, entry := range entries {
+		if failure := DetectFailure(entry); failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+	return failures
+}
+
+func isProblem(level Level) bool {
+	return level == LevelError || level == LevelFatal
+}
+
+func firstLine(message string) string {
+	line, _, _ := strings.Cut(message, "\n")
+	return strings.TrimSpace(line)
+}
+
+// splitPluginName splits "Name 1.2.3" into its name and version.
+func splitPluginName(plugin string) (string, string) {
+	index := strings.LastIndex(plugin, " ")
+	if index < 0 {
+		return plugin, ""
+	}
+	return plugin[:index], plugin[index+1:]
+}
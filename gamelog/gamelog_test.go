@@ -0,0 +1,75 @@
+package gamelog
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleLog = `[Message:   BepInEx] BepInEx 5.4.21.0 - Lethal Company (1/20/2024 5:20:10 PM)
+[Info   :   BepInEx] Loading [LethalLib 0.13.2]
+[Info   :   BepInEx] Loading [MoreCompany 1.7.4]
+[Error  :   BepInEx] Error loading [MoreCompany 1.7.4] : Exception has been thrown by the target of an invocation.
+System.NullReferenceException: Object reference not set to an instance of an object
+  at MoreCompany.Plugin.Awake () [0x00000] in <filename unknown>:0
+[Error  :   BepInEx] Could not load [ShipLoot 1.0.0] because it has missing dependencies: evaisa.lethallib
+[Warning:   BepInEx] Skipping [LethalLib 0.13.0] because a newer version exists (LethalLib 0.13.2)
+[Warning:   BepInEx] Plugin [OldMod 1.0.0] targets a wrong version of BepInEx (6.0.0) and might not work until you update
+[Message:   BepInEx] Chainloader startup complete
+`
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(sampleLog))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	if len(entries) != 8 {
+		t.Fatalf("Parse() returned %d entries, want 8", len(entries))
+	}
+
+	if entries[1].Level != LevelInfo || entries[1].Source != "BepInEx" || entries[1].Message != "Loading [LethalLib 0.13.2]" {
+		t.Errorf("unexpected entry: %+v", entries[1])
+	}
+
+	if !strings.Contains(entries[3].Message, "NullReferenceException") {
+		t.Errorf("stack trace was not appended to the previous entry: %q", entries[3].Message)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	entries, err := Parse(strings.NewReader(sampleLog))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	summary := Summarize(entries)
+	if !summary.ChainloaderDone {
+		t.Errorf("ChainloaderDone = false, want true")
+	}
+
+	want := map[string]PluginStatus{
+		"LethalLib 0.13.2":  PluginLoaded,
+		"MoreCompany 1.7.4": PluginFailed,
+		"ShipLoot 1.0.0":    PluginFailed,
+		"LethalLib 0.13.0":  PluginSkipped,
+		"OldMod 1.0.0":      PluginLoaded,
+	}
+	for _, plugin := range summary.Plugins {
+		fullName := plugin.Name + " " + plugin.Version
+		if status, ok := want[fullName]; !ok {
+			t.Errorf("unexpected plugin %s", fullName)
+		} else if plugin.Status != status {
+			t.Errorf("plugin %s status = %s, want %s", fullName, plugin.Status, status)
+		}
+	}
+
+	kinds := map[FailureKind]bool{}
+	for _, failure := range DetectFailures(entries) {
+		kinds[failure.Kind] = true
+	}
+	for _, kind := range []FailureKind{PluginLoadException, MissingDependency, DuplicateGUID, IncompatibleBepInEx} {
+		if !kinds[kind] {
+			t.Errorf("failure %s was not detected", kind)
+		}
+	}
+}
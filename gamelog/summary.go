@@ -0,0 +1,155 @@
+package gamelog
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+)
+
+type PluginStatus string
+
+const (
+	PluginLoaded  PluginStatus = "loaded"
+	PluginFailed  PluginStatus = "failed"
+	PluginSkipped PluginStatus = "skipped"
+)
+
+// PluginSummary is the load result of a single plugin.
+type PluginSummary struct {
+	Name     string       `json:"name"`
+	Version  string       `json:"version"`
+	Status   PluginStatus `json:"status"`
+	Failures []Failure    `json:"failures"`
+	// ModDirName is the installed mod the plugin belongs to, empty if it could not be matched.
+	ModDirName string `json:"mod_dir_name"`
+}
+
+// Summary is the result of analysing a profile's LogOutput.log.
+type Summary struct {
+	Plugins []PluginSummary `json:"plugins"`
+	// Failures that could not be tied to a plugin, e.g. unhandled exceptions.
+	Failures []Failure `json:"failures"`
+	// ChainloaderDone is true when BepInEx finished loading plugins.
+	ChainloaderDone bool `json:"chainloader_done"`
+}
+
+// LogPath returns the path of the BepInEx log of the profile.
+func LogPath(profileName string) string {
+	return filepath.Join(filesystem.ProfilePath(profileName), "BepInEx", LogFileName)
+}
+
+// Summarize builds a per-plugin load summary from the entries.
+func Summarize(entries []Entry) *Summary {
+	summary := &Summary{}
+	plugins := map[string]*PluginSummary{}
+	var order []string
+
+	plugin := func(fullName string) *PluginSummary {
+		if existing, ok := plugins[fullName]; ok {
+			return existing
+		}
+		name, version := splitPluginName(fullName)
+		plugins[fullName] = &PluginSummary{Name: name, Version: version, Status: PluginLoaded}
+		order = append(order, fullName)
+		return plugins[fullName]
+	}
+
+	for _, entry := range entries {
+		message := firstLine(entry.Message)
+		if strings.Contains(message, "Chainloader startup complete") {
+			summary.ChainloaderDone = true
+		}
+
+		if match := loadingPattern.FindStringSubmatch(message); match != nil {
+			plugin(match[1])
+			continue
+		}
+
+		failure := DetectFailure(entry)
+		if failure == nil {
+			continue
+		}
+		if failure.Plugin == "" {
+			summary.Failures = append(summary.Failures, *failure)
+			continue
+		}
+
+		p := plugin(failure.Plugin)
+		p.Failures = append(p.Failures, *failure)
+		switch failure.Kind {
+		case DuplicateGUID:
+			if p.Status != PluginFailed {
+				p.Status = PluginSkipped
+			}
+		case IncompatibleBepInEx:
+			// BepInEx still loads plugins that target a different version.
+		default:
+			p.Status = PluginFailed
+		}
+	}
+
+	for _, fullName := range order {
+		summary.Plugins = append(summary.Plugins, *plugins[fullName])
+	}
+	return summary
+}
+
+// SummarizeProfile parses the profile's LogOutput.log and ties every plugin
+// back to the installed mod it most likely belongs to.
+func SummarizeProfile(profileName string) (*Summary, error) {
+	entries, err := ParseFile(LogPath(profileName))
+	if err != nil {
+		return nil, err
+	}
+
+	mods, err := modmanager.ListMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := Summarize(entries)
+	for i := range summary.Plugins {
+		summary.Plugins[i].ModDirName = matchMod(summary.Plugins[i].Name, mods)
+	}
+
+	return summary, nil
+}
+
+// matchMod finds the mod whose manifest name matches the plugin name.
+// Exact matches win over partial ones.
+func matchMod(pluginName string, mods []modmanager.ModDetails) string {
+	normalizedPlugin := normalizeName(pluginName)
+	if normalizedPlugin == "" {
+		return ""
+	}
+
+	partial := ""
+	for _, mod := range mods {
+		normalizedMod := normalizeName(mod.Manifest.Name)
+		if normalizedMod == "" {
+			continue
+		}
+		if normalizedMod == normalizedPlugin {
+			return mod.ModDirName
+		}
+		if partial == "" && (strings.Contains(normalizedMod, normalizedPlugin) || strings.Contains(normalizedPlugin, normalizedMod)) {
+			partial = mod.ModDirName
+		}
+	}
+
+	return partial
+}
+
+// normalizeName lowercases the name and keeps only letters and digits,
+// so "More Company" matches the package name "MoreCompany".
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,112 @@
+package gamelog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// TailInterval is how often Tail polls the log file for new lines.
+var TailInterval = 250 * time.Millisecond
+
+// TailFlushDelay is how long Tail waits for continuation lines, e.g. the rest of a
+// stack trace, before it sends the entry they would belong to.
+var TailFlushDelay = time.Second
+
+// Tail follows the log file at logPath and sends every parsed entry to entries
+// until ctx is cancelled. The file may not exist yet; BepInEx creates it when the
+// game starts. When the file is truncated or recreated, reading starts over.
+// Entries still waiting for continuation lines are sent once the file didn't grow
+// for TailFlushDelay.
+func Tail(ctx context.Context, logPath string, entries chan<- Entry) error {
+	var (
+		file    *os.File
+		reader  *bufio.Reader
+		offset  int64
+		partial string
+		parser  Parser
+		// lastGrowth is when the file last grew, zero when there's no entry to flush.
+		lastGrowth time.Time
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	send := func(entry *Entry) error {
+		if entry == nil {
+			return nil
+		}
+		select {
+		case entries <- *entry:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	ticker := time.NewTicker(TailInterval)
+	defer ticker.Stop()
+
+	for {
+		if file == nil {
+			opened, err := os.Open(logPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				file, reader, offset, partial, parser = opened, bufio.NewReader(opened), 0, "", Parser{}
+			}
+		}
+
+		if file != nil {
+			if info, err := os.Stat(logPath); err != nil || info.Size() < offset {
+				// The log was removed or truncated by a new game start.
+				lastGrowth = time.Time{}
+				if err := send(parser.Flush()); err != nil {
+					return err
+				}
+				file.Close()
+				file = nil
+				continue
+			}
+
+			grew := false
+			for {
+				chunk, err := reader.ReadString('\n')
+				offset += int64(len(chunk))
+				if err == io.EOF {
+					partial += chunk
+					break
+				} else if err != nil {
+					return err
+				}
+
+				grew = true
+				lastGrowth = time.Now()
+				line := partial + strings.TrimSuffix(chunk, "\n")
+				partial = ""
+				if err := send(parser.Feed(line, time.Now())); err != nil {
+					return err
+				}
+			}
+
+			if !grew && !lastGrowth.IsZero() && time.Since(lastGrowth) >= TailFlushDelay {
+				lastGrowth = time.Time{}
+				if err := send(parser.Flush()); err != nil {
+					return err
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package gamelog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailWaitsForContinuationLines(t *testing.T) {
+	interval, delay := TailInterval, TailFlushDelay
+	defer func() { TailInterval, TailFlushDelay = interval, delay }()
+	TailInterval = 10 * time.Millisecond
+	TailFlushDelay = 200 * time.Millisecond
+
+	logPath := filepath.Join(t.TempDir(), LogFileName)
+	file, err := os.Create(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entries := make(chan Entry, 10)
+	go Tail(ctx, logPath, entries)
+
+	file.WriteString("[Error  :   BepInEx] Error loading [MoreCompany 1.7.4]\n")
+	// The rest of the stack trace arrives after a few polls without growth.
+	time.Sleep(5 * TailInterval)
+	file.WriteString("System.NullReferenceException: Object reference not set to an instance of an object\n")
+
+	select {
+	case entry := <-entries:
+		if !strings.Contains(entry.Message, "NullReferenceException") {
+			t.Errorf("Tail() sent %q without its continuation line", entry.Message)
+		}
+	case <-ctx.Done():
+		t.Fatal("Tail() did not send the entry after the flush delay")
+	}
+}
@@ -3,10 +3,14 @@ module github.com/The-Lethal-Foundation/lethal-core
 go 1.21.6
 
 require (
-	github.com/PuerkitoBio/goquery v1.8.1 // indirect
+	github.com/PuerkitoBio/goquery v1.8.1
+	github.com/otiai10/copy v1.14.0
+	golang.org/x/sys v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/andybalholm/cascadia v1.3.1 // indirect
-	github.com/otiai10/copy v1.14.0 // indirect
 	golang.org/x/net v0.7.0 // indirect
 	golang.org/x/sync v0.3.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
 )
@@ -0,0 +1,63 @@
+package fileutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// CopyFile copies the contents and permissions of src to dst, replacing dst.
+func CopyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// LinkFile hard-links dst to src, replacing dst. Both names then refer to the same
+// file, so writing one changes the other. When the filesystem can't link the two
+// paths, e.g. because they are on different devices, it falls back to CopyFile.
+func LinkFile(src, dst string) error {
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err := os.Link(src, dst)
+	if err == nil || !(errors.Is(err, errors.ErrUnsupported) || linkUnsupported(err)) {
+		return err
+	}
+	return CopyFile(src, dst)
+}
+
+// HashFile returns the hex encoded SHA-256 of the file contents.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// linkUnsupported reports whether os.Link failed because the paths can't be linked,
+// rather than because of the files themselves.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EMLINK) ||
+		errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package fileutil
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// linkUnsupported reports whether os.Link failed because the paths can't be linked,
+// rather than because of the files themselves.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE) || errors.Is(err, windows.ERROR_INVALID_FUNCTION) ||
+		errors.Is(err, windows.ERROR_NOT_SUPPORTED) || errors.Is(err, windows.ERROR_TOO_MANY_LINKS)
+}
@@ -0,0 +1,38 @@
+package fileutil
+
+import (
+	"os"
+)
+
+// LockSuffix is appended to a file's path to get the lock file guarding it.
+const LockSuffix = ".lock"
+
+// Lock is a cross-process advisory lock held on a lock file.
+type Lock struct {
+	file *os.File
+}
+
+// LockFile blocks until it holds the exclusive lock guarding path. The lock only
+// keeps out other users of LockFile, it doesn't stop plain reads and writes.
+func LockFile(path string) (*Lock, error) {
+	file, err := os.OpenFile(path+LockSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Lock{file: file}, nil
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
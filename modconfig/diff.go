@@ -0,0 +1,53 @@
+package modconfig
+
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// Change is a difference of a single entry between two config files.
+type Change struct {
+	// File is the config file path the change was found in, set by callers comparing directories.
+	File     string     `json:"file"`
+	Section  string     `json:"section"`
+	Key      string     `json:"key"`
+	Kind     ChangeKind `json:"kind"`
+	OldValue string     `json:"old_value"`
+	NewValue string     `json:"new_value"`
+}
+
+// Diff compares the entries of two files. Entries only in to are Added, entries
+// only in from are Removed, and entries whose values differ are Changed.
+// Either file may be nil, meaning it does not exist.
+func Diff(from, to *File) []Change {
+	var changes []Change
+
+	if from != nil {
+		for _, entry := range from.Entries() {
+			var other *Entry
+			if to != nil {
+				other = to.Entry(entry.Section, entry.Key)
+			}
+
+			switch {
+			case other == nil:
+				changes = append(changes, Change{Section: entry.Section, Key: entry.Key, Kind: Removed, OldValue: entry.Value})
+			case other.Value != entry.Value:
+				changes = append(changes, Change{Section: entry.Section, Key: entry.Key, Kind: Changed, OldValue: entry.Value, NewValue: other.Value})
+			}
+		}
+	}
+
+	if to != nil {
+		for _, entry := range to.Entries() {
+			if from == nil || from.Entry(entry.Section, entry.Key) == nil {
+				changes = append(changes, Change{Section: entry.Section, Key: entry.Key, Kind: Added, NewValue: entry.Value})
+			}
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,417 @@
+package modconfig
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+)
+
+const (
+	settingTypePrefix      = "# Setting type:"
+	defaultValuePrefix     = "# Default value:"
+	acceptableValuesPrefix = "# Acceptable values:"
+	acceptableRangePrefix  = "# Acceptable value range:"
+	multipleValuesHint     = "# Multiple values can be set at the same time"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// line is a single line of the file. Entries point at their value line, so the
+// file can be written back with every comment, blank and unknown line left in place.
+type line struct {
+	text string
+}
+
+// Range is an "Acceptable value range: From Min to Max" declaration.
+type Range struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// Entry is a single setting of a BepInEx config file.
+type Entry struct {
+	Section          string   `json:"section"`
+	Key              string   `json:"key"`
+	Value            string   `json:"value"`
+	Description      string   `json:"description"`
+	SettingType      string   `json:"setting_type"`
+	DefaultValue     string   `json:"default_value"`
+	HasDefault       bool     `json:"has_default"`
+	AcceptableValues []string `json:"acceptable_values"`
+	AcceptableRange  *Range   `json:"acceptable_range"`
+	// Flags is set for enum settings that accept several comma separated values.
+	Flags bool `json:"flags"`
+
+	line *line
+}
+
+// Section is a [Section] of a BepInEx config file.
+type Section struct {
+	Name    string   `json:"name"`
+	Entries []*Entry `json:"entries"`
+
+	header *line
+	last   *line
+}
+
+// File is a parsed BepInEx config file.
+type File struct {
+	Sections []*Section `json:"sections"`
+
+	lines           []*line
+	newline         string
+	trailingNewline bool
+	bom             bool
+}
+
+// New returns an empty config file, written with a BOM and CRLF line endings like BepInEx does.
+func New() *File {
+	return &File{newline: "\r\n", trailingNewline: true, bom: true}
+}
+
+// Parse reads a BepInEx config file.
+func Parse(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{newline: "\n", trailingNewline: len(data) == 0 || bytes.HasSuffix(data, []byte("\n"))}
+	if bytes.Contains(data, []byte("\r\n")) {
+		file.newline = "\r\n"
+	}
+
+	// BepInEx writes files with a UTF-8 BOM; keep it for writing the file back.
+	if bytes.HasPrefix(data, utf8BOM) {
+		file.bom = true
+		data = data[len(utf8BOM):]
+	}
+
+	var section *Section
+	pending := &Entry{}
+	var description []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		current := &line{text: strings.TrimRight(scanner.Text(), "\r")}
+		file.lines = append(file.lines, current)
+		text := strings.TrimSpace(current.text)
+
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "##"):
+			description = append(description, strings.TrimSpace(strings.TrimPrefix(text, "##")))
+		case strings.HasPrefix(text, settingTypePrefix):
+			pending.SettingType = strings.TrimSpace(strings.TrimPrefix(text, settingTypePrefix))
+		case strings.HasPrefix(text, defaultValuePrefix):
+			pending.DefaultValue = strings.TrimSpace(strings.TrimPrefix(text, defaultValuePrefix))
+			pending.HasDefault = true
+		case strings.HasPrefix(text, acceptableValuesPrefix):
+			for _, value := range strings.Split(strings.TrimPrefix(text, acceptableValuesPrefix), ",") {
+				pending.AcceptableValues = append(pending.AcceptableValues, strings.TrimSpace(value))
+			}
+		case strings.HasPrefix(text, acceptableRangePrefix):
+			pending.AcceptableRange = parseRange(strings.TrimPrefix(text, acceptableRangePrefix))
+		case strings.HasPrefix(text, multipleValuesHint):
+			pending.Flags = true
+		case strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";"):
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+			section = &Section{Name: strings.TrimSpace(text[1 : len(text)-1]), header: current, last: current}
+			file.Sections = append(file.Sections, section)
+			pending, description = &Entry{}, nil
+		default:
+			key, value, found := strings.Cut(text, "=")
+			if !found {
+				// Lines BepInEx would ignore are kept as they are, so they survive a rewrite.
+				break
+			}
+			if section == nil {
+				return nil, fmt.Errorf("line %d: entry %q is outside of a section", lineNumber, strings.TrimSpace(key))
+			}
+
+			pending.Section = section.Name
+			pending.Key = strings.TrimSpace(key)
+			pending.Value = strings.TrimSpace(value)
+			pending.Description = strings.Join(description, "\n")
+			pending.line = current
+			section.Entries = append(section.Entries, pending)
+			pending, description = &Entry{}, nil
+		}
+
+		if section != nil {
+			section.last = current
+		}
+	}
+
+	return file, scanner.Err()
+}
+
+// ParseFile reads the BepInEx config file at path.
+func ParseFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// parseRange parses " From 0 to 100".
+func parseRange(text string) *Range {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "From ")
+	min, max, found := strings.Cut(text, " to ")
+	if !found {
+		return nil
+	}
+	return &Range{Min: strings.TrimSpace(min), Max: strings.TrimSpace(max)}
+}
+
+// Bytes returns the file contents, with every line that was not changed kept as it was read.
+func (f *File) Bytes() []byte {
+	var out bytes.Buffer
+	if f.bom {
+		out.Write(utf8BOM)
+	}
+	for i, l := range f.lines {
+		out.WriteString(l.text)
+		if i < len(f.lines)-1 || f.trailingNewline {
+			out.WriteString(f.newline)
+		}
+	}
+	return out.Bytes()
+}
+
+// Save writes the file to path. The file is replaced at once, so BepInEx never reads a half-written config.
+func (f *File) Save(path string) error {
+	return fileutil.WriteFile(path, f.Bytes(), 0644)
+}
+
+// Section returns the section with the given name.
+func (f *File) Section(name string) *Section {
+	for _, section := range f.Sections {
+		if section.Name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+// Entry returns the entry with the given section and key.
+func (f *File) Entry(section, key string) *Entry {
+	s := f.Section(section)
+	if s == nil {
+		return nil
+	}
+	for _, entry := range s.Entries {
+		if entry.Key == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Entries returns every entry of the file in order.
+func (f *File) Entries() []*Entry {
+	var entries []*Entry
+	for _, section := range f.Sections {
+		entries = append(entries, section.Entries...)
+	}
+	return entries
+}
+
+// Set validates and sets the value of an existing entry.
+func (f *File) Set(section, key, value string) error {
+	entry := f.Entry(section, key)
+	if entry == nil {
+		return fmt.Errorf("entry [%s] %s does not exist", section, key)
+	}
+	return entry.Set(value)
+}
+
+// ResetToDefault sets the entry back to its declared default value.
+func (f *File) ResetToDefault(section, key string) error {
+	entry := f.Entry(section, key)
+	if entry == nil {
+		return fmt.Errorf("entry [%s] %s does not exist", section, key)
+	}
+	return entry.ResetToDefault()
+}
+
+// Validate checks every entry against its declared type and acceptable values.
+func (f *File) Validate() []error {
+	var errs []error
+	for _, entry := range f.Entries() {
+		if err := entry.Validate(entry.Value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// AddSection appends a new empty section to the file and returns it.
+// The existing section is returned if there already is one with the name.
+func (f *File) AddSection(name string) *Section {
+	if section := f.Section(name); section != nil {
+		return section
+	}
+
+	if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1].text) != "" {
+		f.lines = append(f.lines, &line{})
+	}
+	header := &line{text: "[" + name + "]"}
+	f.lines = append(f.lines, header)
+
+	section := &Section{Name: name, header: header, last: header}
+	f.Sections = append(f.Sections, section)
+	return section
+}
+
+// AddEntry copies the entry, with its description and metadata comments, into the file.
+// An existing entry with the same section and key only gets its value replaced.
+func (f *File) AddEntry(entry *Entry) {
+	if existing := f.Entry(entry.Section, entry.Key); existing != nil {
+		existing.setValue(entry.Value)
+		return
+	}
+
+	section := f.AddSection(entry.Section)
+
+	var block []*line
+	block = append(block, &line{})
+	if entry.Description != "" {
+		for _, descriptionLine := range strings.Split(entry.Description, "\n") {
+			block = append(block, &line{text: "## " + descriptionLine})
+		}
+	}
+	if entry.SettingType != "" {
+		block = append(block, &line{text: settingTypePrefix + " " + entry.SettingType})
+	}
+	if entry.HasDefault {
+		block = append(block, &line{text: strings.TrimRight(defaultValuePrefix+" "+entry.DefaultValue, " ")})
+	}
+	if len(entry.AcceptableValues) > 0 {
+		block = append(block, &line{text: acceptableValuesPrefix + " " + strings.Join(entry.AcceptableValues, ", ")})
+	}
+	if entry.AcceptableRange != nil {
+		block = append(block, &line{text: fmt.Sprintf("%s From %s to %s", acceptableRangePrefix, entry.AcceptableRange.Min, entry.AcceptableRange.Max)})
+	}
+
+	added := *entry
+	added.AcceptableValues = append([]string(nil), entry.AcceptableValues...)
+	added.line = &line{}
+	added.setValue(entry.Value)
+	block = append(block, added.line)
+
+	f.insertAfter(section.last, block)
+	section.last = added.line
+	section.Entries = append(section.Entries, &added)
+}
+
+// RemoveEntry removes the entry and its comment block from the file.
+func (f *File) RemoveEntry(section, key string) bool {
+	s := f.Section(section)
+	if s == nil {
+		return false
+	}
+
+	for i, entry := range s.Entries {
+		if entry.Key != key {
+			continue
+		}
+
+		end := f.indexOf(entry.line)
+		start := end
+		for start > 0 {
+			text := strings.TrimSpace(f.lines[start-1].text)
+			if !strings.HasPrefix(text, "#") {
+				break
+			}
+			start--
+		}
+
+		if s.last == entry.line {
+			s.last = f.lines[start-1]
+		}
+		f.lines = append(f.lines[:start], f.lines[end+1:]...)
+		s.Entries = append(s.Entries[:i], s.Entries[i+1:]...)
+		return true
+	}
+	return false
+}
+
+func (f *File) indexOf(target *line) int {
+	for i, l := range f.lines {
+		if l == target {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *File) insertAfter(after *line, block []*line) {
+	index := f.indexOf(after) + 1
+	f.lines = append(f.lines[:index], append(block, f.lines[index:]...)...)
+}
+
+// setValue changes the value and rewrites the entry's line.
+func (e *Entry) setValue(value string) {
+	e.Value = value
+	e.line.text = e.Key + " = " + value
+}
+
+// Set validates the value against the entry's declared type and acceptable values, then sets it.
+func (e *Entry) Set(value string) error {
+	if err := e.Validate(value); err != nil {
+		return err
+	}
+	e.setValue(value)
+	return nil
+}
+
+// ResetToDefault sets the entry back to its declared default value.
+func (e *Entry) ResetToDefault() error {
+	if !e.HasDefault {
+		return fmt.Errorf("entry [%s] %s has no default value", e.Section, e.Key)
+	}
+	e.setValue(e.DefaultValue)
+	return nil
+}
+
+// Bool returns the value of a Boolean setting.
+func (e *Entry) Bool() (bool, error) {
+	return parseBool(e.Value)
+}
+
+// Int returns the value of an integer setting.
+func (e *Entry) Int() (int64, error) {
+	return strconv.ParseInt(e.Value, 10, 64)
+}
+
+// Float returns the value of a Single or Double setting.
+func (e *Entry) Float() (float64, error) {
+	return strconv.ParseFloat(e.Value, 64)
+}
+
+// SetBool sets the value of a Boolean setting.
+func (e *Entry) SetBool(value bool) error {
+	return e.Set(strconv.FormatBool(value))
+}
+
+// SetInt sets the value of an integer setting.
+func (e *Entry) SetInt(value int64) error {
+	return e.Set(strconv.FormatInt(value, 10))
+}
+
+// SetFloat sets the value of a Single or Double setting.
+func (e *Entry) SetFloat(value float64) error {
+	return e.Set(strconv.FormatFloat(value, 'f', -1, 64))
+}
@@ -0,0 +1,128 @@
+package modconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sampleConfig = "\ufeff## Settings file was created by plugin MoreCompany v1.7.4\r\n" +
+	"## Plugin GUID: me.swipez.melonloader.morecompany\r\n" +
+	"\r\n" +
+	"[Cosmetics]\r\n" +
+	"\r\n" +
+	"## Should the cosmetics be enabled?\r\n" +
+	"# Setting type: Boolean\r\n" +
+	"# Default value: true\r\n" +
+	"Cosmetics Enabled = false\r\n" +
+	"\r\n" +
+	"[General]\r\n" +
+	"\r\n" +
+	"## Maximum player count\r\n" +
+	"# Setting type: Int32\r\n" +
+	"# Default value: 32\r\n" +
+	"# Acceptable value range: From 1 to 50\r\n" +
+	"Player Count = 32\r\n" +
+	"\r\n" +
+	"## Log levels\r\n" +
+	"# Setting type: LogLevel\r\n" +
+	"# Default value: Info\r\n" +
+	"# Acceptable values: None, Info, Warning, Error\r\n" +
+	"# Multiple values can be set at the same time by separating them with , (e.g. Debug, Warning)\r\n" +
+	"Level = Info, Warning\r\n"
+
+func TestRoundTrip(t *testing.T) {
+	file, err := Parse(strings.NewReader(sampleConfig))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	if got := string(file.Bytes()); got != sampleConfig {
+		t.Errorf("Bytes() did not round-trip:\n%q\nwant:\n%q", got, sampleConfig)
+	}
+
+	if errs := file.Validate(); len(errs) != 0 {
+		t.Errorf("Validate() = %v, want no errors", errs)
+	}
+}
+
+func TestSetAndReset(t *testing.T) {
+	file, err := Parse(strings.NewReader(sampleConfig))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	entry := file.Entry("General", "Player Count")
+	if entry == nil || entry.Description != "Maximum player count" || entry.AcceptableRange == nil {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+
+	if err := entry.SetInt(64); !errors.As(err, new(*ValidationError)) {
+		t.Errorf("SetInt(64) error = %v, want a ValidationError", err)
+	}
+	if err := file.Set("General", "Player Count", "abc"); err == nil {
+		t.Errorf("Set(abc) succeeded, want an error")
+	}
+	if err := entry.SetInt(8); err != nil {
+		t.Fatalf("SetInt(8) failed: %v", err)
+	}
+	if err := file.Set("General", "Level", "Error, Banana"); err == nil {
+		t.Errorf("Set(Error, Banana) succeeded, want an error")
+	}
+
+	if err := file.ResetToDefault("Cosmetics", "Cosmetics Enabled"); err != nil {
+		t.Fatalf("ResetToDefault() failed: %v", err)
+	}
+
+	want := strings.Replace(sampleConfig, "Player Count = 32", "Player Count = 8", 1)
+	want = strings.Replace(want, "Cosmetics Enabled = false", "Cosmetics Enabled = true", 1)
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("Bytes() after edits:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestAddEntry(t *testing.T) {
+	file, err := Parse(strings.NewReader(sampleConfig))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	source := file.Entry("General", "Player Count")
+	added := *source
+	added.Section = "Extra"
+	file.AddEntry(&added)
+
+	reparsed, err := Parse(strings.NewReader(string(file.Bytes())))
+	if err != nil {
+		t.Fatalf("Parse() of the edited file failed: %v", err)
+	}
+	entry := reparsed.Entry("Extra", "Player Count")
+	if entry == nil || entry.Value != "32" || entry.SettingType != "Int32" || entry.AcceptableRange == nil {
+		t.Errorf("added entry did not survive a round-trip: %+v", entry)
+	}
+}
+
+func TestUnknownLinesAndBooleans(t *testing.T) {
+	config := strings.Replace(sampleConfig, "[General]\r\n", "[General]\r\nnot a setting\r\n", 1)
+	file, err := Parse(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	if err := file.Set("General", "Player Count", "8"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	want := strings.Replace(config, "Player Count = 32", "Player Count = 8", 1)
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("Bytes() lost the unknown line:\n%q\nwant:\n%q", got, want)
+	}
+
+	for _, value := range []string{"1", "t", "yes"} {
+		if err := file.Set("Cosmetics", "Cosmetics Enabled", value); err == nil {
+			t.Errorf("Set(%s) succeeded, want an error", value)
+		}
+	}
+	if err := file.Set("Cosmetics", "Cosmetics Enabled", "True"); err != nil {
+		t.Errorf("Set(True) failed: %v", err)
+	}
+}
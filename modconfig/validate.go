@@ -0,0 +1,113 @@
+package modconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is returned when a value does not match the entry's declared
+// setting type or acceptable values.
+type ValidationError struct {
+	Section string
+	Key     string
+	Value   string
+	Reason  string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid value %q for [%s] %s: %s", e.Value, e.Section, e.Key, e.Reason)
+}
+
+// integerTypes maps the .NET integer setting types to their bit size and signedness.
+var integerTypes = map[string]struct {
+	bits   int
+	signed bool
+}{
+	"Byte":   {8, false},
+	"SByte":  {8, true},
+	"Int16":  {16, true},
+	"UInt16": {16, false},
+	"Int32":  {32, true},
+	"UInt32": {32, false},
+	"Int64":  {64, true},
+	"UInt64": {64, false},
+}
+
+// parseBool parses a Boolean the way .NET's bool.Parse does: only true and false,
+// in any case. strconv.ParseBool also takes 1, t and the like, which BepInEx rejects.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+// Validate checks the value against the entry's declared setting type, acceptable values and range.
+// Setting types the library does not know about are only checked against their acceptable values.
+func (e *Entry) Validate(value string) error {
+	invalid := func(format string, args ...any) error {
+		return &ValidationError{Section: e.Section, Key: e.Key, Value: value, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	switch {
+	case e.SettingType == "Boolean":
+		if _, err := parseBool(value); err != nil {
+			return invalid("expected true or false")
+		}
+	case e.SettingType == "Single" || e.SettingType == "Double":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return invalid("expected a number")
+		}
+	default:
+		if integerType, ok := integerTypes[e.SettingType]; ok {
+			var err error
+			if integerType.signed {
+				_, err = strconv.ParseInt(value, 10, integerType.bits)
+			} else {
+				_, err = strconv.ParseUint(value, 10, integerType.bits)
+			}
+			if err != nil {
+				return invalid("expected a whole number fitting in %s", e.SettingType)
+			}
+		}
+	}
+
+	if len(e.AcceptableValues) > 0 {
+		values := []string{value}
+		if e.Flags {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if !e.isAcceptable(strings.TrimSpace(v)) {
+				return invalid("expected one of %s", strings.Join(e.AcceptableValues, ", "))
+			}
+		}
+	}
+
+	if e.AcceptableRange != nil {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return invalid("expected a number")
+		}
+		min, minErr := strconv.ParseFloat(e.AcceptableRange.Min, 64)
+		max, maxErr := strconv.ParseFloat(e.AcceptableRange.Max, 64)
+		if (minErr == nil && number < min) || (maxErr == nil && number > max) {
+			return invalid("expected a value from %s to %s", e.AcceptableRange.Min, e.AcceptableRange.Max)
+		}
+	}
+
+	return nil
+}
+
+func (e *Entry) isAcceptable(value string) bool {
+	for _, acceptable := range e.AcceptableValues {
+		if acceptable == value {
+			return true
+		}
+	}
+	return false
+}
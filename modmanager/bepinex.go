@@ -2,80 +2,204 @@ package modmanager
 
 import (
 	"archive/zip"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/api"
+	"github.com/The-Lethal-Foundation/lethal-core/assembly"
 	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
 )
 
 // BepInExRelease represents the structure of a GitHub release.
 type BepInExRelease struct {
-	TagName string `json:"tag_name"`
-	Assets  []struct {
-		BrowserDownloadURL string `json:"browser_download_url"`
-	} `json:"assets"`
+	TagName    string         `json:"tag_name"`
+	Prerelease bool           `json:"prerelease"`
+	Assets     []BepInExAsset `json:"assets"`
 }
 
-const bepInExRepoURL = "https://api.github.com/repos/BepInEx/BepInEx/releases/latest"
+// BepInExAsset is a file attached to a GitHub release.
+type BepInExAsset struct {
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	Digest             string `json:"digest"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// CachedBepInEx is a BepInEx release archive in the cache.
+type CachedBepInEx struct {
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	Path     string `json:"path"`
+}
+
+// Platforms BepInEx is released for. Lethal Company only ships a Windows build,
+// so win_x64 is also what Proton needs on Linux.
+const (
+	BepInExPlatformWindows = "win_x64"
+	BepInExPlatformUnix    = "unix"
+)
+
+// BepInExPlatform is the platform used when a BepInEx release is picked.
+var BepInExPlatform = BepInExPlatformWindows
+
+const bepInExReleasesURL = "https://api.github.com/repos/BepInEx/BepInEx/releases"
+const bepInExRepoURL = bepInExReleasesURL + "/latest"
 const bepInExCacheDir = filesystem.DefaultCacheDir
 
+// bepInExVersionsDir holds the cached releases as <tag>/<platform>.zip inside the cache dir.
+const bepInExVersionsDir = "BepInEx"
+
+// bepInExStagingPrefix starts the directories BepInEx is unpacked into inside the cache dir.
+const bepInExStagingPrefix = "bepinex-staging-"
+
+// bepInExRootFiles are the files at the root of a BepInEx release that are
+// replaced together with BepInEx/core.
+var bepInExRootFiles = []string{".doorstop_version", "changelog.txt", "winhttp.dll", "run_bepinex.sh", "libdoorstop.so", "libdoorstop.dylib"}
+
+// bepInExDefaultFiles are only unpacked into a profile that doesn't have them yet,
+// so changes users made to them survive version switches.
+var bepInExDefaultFiles = []string{"doorstop_config.ini", "BepInEx/config/BepInEx.cfg"}
+
 // FetchLatestBepInExVersion fetches the latest stable release version of BepInEx from GitHub.
 func FetchLatestBepInExVersion() (string, error) {
-	resp, err := http.Get(bepInExRepoURL)
+	release, err := FetchBepInExRelease("")
 	if err != nil {
 		return "", err
 	}
+
+	return release.TagName, nil
+}
+
+// FetchBepInExRelease fetches the release with the given version from GitHub.
+// An empty version fetches the latest stable release.
+func FetchBepInExRelease(version string) (*BepInExRelease, error) {
+	if api.IsOffline() {
+		return nil, fmt.Errorf("BepInEx release %s: %w", version, api.ErrNotCached)
+	}
+
+	url := bepInExRepoURL
+	if version != "" {
+		url = bepInExReleasesURL + "/tags/" + bepInExTag(version)
+	}
+
+	resp, err := api.HTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching BepInEx release %s: %s", version, resp.Status)
+	}
+
 	var release BepInExRelease
 	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return release.TagName, nil
+	return &release, nil
 }
 
-// DownloadAndCacheBepInEx downloads and caches the latest BepInEx release.
-// Returns the path to the downloaded zip file.
-func DownloadAndCacheBepInEx(basePath string, version string) (string, error) {
-	cachePath := filepath.Join(basePath, bepInExCacheDir)
-	if err := os.MkdirAll(cachePath, 0755); err != nil {
-		return "", err
+// ListBepInExReleases lists the most recent BepInEx releases on GitHub, including pre-releases.
+func ListBepInExReleases() ([]BepInExRelease, error) {
+	if api.IsOffline() {
+		return nil, fmt.Errorf("BepInEx releases: %w", api.ErrNotCached)
 	}
 
-	// Fetch release information.
-	resp, err := http.Get(bepInExRepoURL)
+	resp, err := api.HTTPClient.Get(bepInExReleasesURL)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var release BepInExRelease
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return "", err
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching BepInEx releases: %s", resp.Status)
+	}
+
+	var releases []BepInExRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// Asset returns the release archive for the platform.
+// Asset names changed over time, e.g. BepInEx_x64_5.4.22.0.zip, BepInEx_win_x64_5.4.23.2.zip
+// and BepInEx-Unity.Mono-win-x64-6.0.0-pre.2.zip.
+func (r *BepInExRelease) Asset(platform string) (*BepInExAsset, error) {
+	var patterns []string
+	switch platform {
+	case BepInExPlatformWindows:
+		patterns = []string{"_win_x64_", "bepinex_x64_"}
+	case BepInExPlatformUnix:
+		patterns = []string{"_unix_", "_linux_x64_"}
+	default:
+		return nil, fmt.Errorf("unknown BepInEx platform: %s", platform)
+	}
+
+	for i, asset := range r.Assets {
+		name := strings.ReplaceAll(strings.ToLower(asset.Name), "-", "_")
+		if !strings.HasSuffix(name, ".zip") || strings.Contains(name, "il2cpp") {
+			continue
+		}
+		for _, pattern := range patterns {
+			if strings.Contains(name, pattern) {
+				return &r.Assets[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("BepInEx %s has no %s release", r.TagName, platform)
+}
+
+// bepInExTag turns a version like 5.4.23.2 into the release tag v5.4.23.2.
+func bepInExTag(version string) string {
+	if version == "" || strings.HasPrefix(version, "v") {
+		return version
 	}
+	return "v" + version
+}
 
-	// Download the release zip file.
-	zipResp, err := http.Get(release.Assets[0].BrowserDownloadURL)
+// BepInExCachePath returns where the release archive of the version and platform is cached.
+func BepInExCachePath(basePath, version, platform string) string {
+	return filepath.Join(basePath, bepInExCacheDir, bepInExVersionsDir, bepInExTag(version), platform+".zip")
+}
+
+// DownloadAndCacheBepInEx downloads and caches a BepInEx release for BepInExPlatform.
+// An empty version downloads the latest stable release.
+// Returns the path to the downloaded zip file.
+func DownloadAndCacheBepInEx(basePath string, version string) (string, error) {
+	release, err := FetchBepInExRelease(version)
 	if err != nil {
 		return "", err
 	}
-	defer zipResp.Body.Close()
 
-	zipPath := filepath.Join(cachePath, "BepInEx.zip")
-	zipFile, err := os.Create(zipPath)
+	asset, err := release.Asset(BepInExPlatform)
 	if err != nil {
 		return "", err
 	}
-	defer zipFile.Close()
 
-	_, err = io.Copy(zipFile, zipResp.Body)
+	zipPath := BepInExCachePath(basePath, release.TagName, BepInExPlatform)
+	if err := os.MkdirAll(filepath.Dir(zipPath), 0755); err != nil {
+		return "", err
+	}
+
+	// Download the release zip file and check it against the size and digest GitHub reports.
+	err = api.DefaultDownloader.Download(context.Background(), api.DownloadRequest{
+		URL:      asset.BrowserDownloadURL,
+		Path:     zipPath,
+		Expected: api.ExpectedGitHubAsset(asset.Size, asset.Digest),
+	})
 	if err != nil {
 		return "", err
 	}
@@ -83,67 +207,307 @@ func DownloadAndCacheBepInEx(basePath string, version string) (string, error) {
 	return zipPath, nil
 }
 
-// IsBepInExUpToDate checks if the cached version of BepInEx matches the latest stable version.
-func IsBepInExUpToDate(basePath string, currentConfig *config.Config) (bool, error) {
-	latestVersion, err := FetchLatestBepInExVersion()
+// isCachedArchiveValid reports whether a cached archive exists and is readable.
+// Broken archives are removed so they get downloaded again.
+func isCachedArchiveValid(zipPath string) bool {
+	if _, err := os.Stat(zipPath); err != nil {
+		return false
+	}
+
+	if err := api.VerifyDownload(zipPath, filepath.Base(zipPath), api.ExpectedFile{}); err != nil {
+		log.Printf("Removing broken cached archive %s: %v\n", zipPath, err)
+		os.Remove(zipPath)
+		return false
+	}
+	return true
+}
+
+// CacheBepInEx makes sure the version is cached for BepInExPlatform and returns the cached zip.
+func CacheBepInEx(basePath, version string) (string, error) {
+	if version != "" {
+		zipPath := BepInExCachePath(basePath, version, BepInExPlatform)
+		if isCachedArchiveValid(zipPath) {
+			return zipPath, nil
+		}
+	}
+
+	return DownloadAndCacheBepInEx(basePath, version)
+}
+
+// ListCachedBepInEx lists the cached BepInEx releases, newest first.
+func ListCachedBepInEx(basePath string) ([]CachedBepInEx, error) {
+	versionsDir := filepath.Join(basePath, bepInExCacheDir, bepInExVersionsDir)
+	archives, err := filepath.Glob(filepath.Join(versionsDir, "*", "*.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	var cached []CachedBepInEx
+	for _, archive := range archives {
+		cached = append(cached, CachedBepInEx{
+			Version:  filepath.Base(filepath.Dir(archive)),
+			Platform: strings.TrimSuffix(filepath.Base(archive), ".zip"),
+			Path:     archive,
+		})
+	}
+
+	sort.SliceStable(cached, func(i, j int) bool {
+		return CompareVersions(strings.TrimPrefix(cached[i].Version, "v"), strings.TrimPrefix(cached[j].Version, "v")) > 0
+	})
+
+	return cached, nil
+}
+
+// RemoveCachedBepInEx removes a version from the cache.
+func RemoveCachedBepInEx(basePath, version string) error {
+	return os.RemoveAll(filepath.Dir(BepInExCachePath(basePath, version, BepInExPlatform)))
+}
+
+// IsBepInExUpToDate reports whether the profile has the BepInEx release version installed.
+// Without a version, e.g. for profiles that aren't pinned, it is compared against the
+// latest stable release.
+func IsBepInExUpToDate(profilePath, version string) (bool, error) {
+	installed, err := InstalledBepInExVersion(profilePath)
 	if err != nil {
 		return false, err
 	}
 
-	return currentConfig.CachedBepInExVersion == latestVersion, nil
+	if version == "" {
+		version, err = FetchLatestBepInExVersion()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return CompareVersions(installed, strings.TrimPrefix(version, "v")) >= 0, nil
 }
 
 func IsBepInExCached(basePath string) bool {
-	cachePath := filepath.Join(basePath, bepInExCacheDir, "BepInEx.zip")
-	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
-		return false
+	_, err := defaultBepInExZip(basePath)
+	return err == nil
+}
+
+// defaultBepInExZip returns the newest cached stable BepInEx 5 release for BepInExPlatform,
+// or the BepInEx.zip older versions cached. Lethal Company mods are built for BepInEx 5,
+// so cached 6.0 pre-releases are never picked.
+func defaultBepInExZip(basePath string) (string, error) {
+	cached, err := ListCachedBepInEx(basePath)
+	if err != nil {
+		return "", err
 	}
-	return true
+	for _, entry := range cached {
+		if entry.Platform == BepInExPlatform && isStableBepInEx5(entry.Version) {
+			return entry.Path, nil
+		}
+	}
+
+	legacyPath := filepath.Join(basePath, bepInExCacheDir, "BepInEx.zip")
+	if _, err := os.Stat(legacyPath); err != nil {
+		return "", fmt.Errorf("BepInEx is not cached: %w", err)
+	}
+	return legacyPath, nil
+}
+
+// isStableBepInEx5 reports whether the release version, e.g. v5.4.23.2, is a stable BepInEx 5 release.
+func isStableBepInEx5(version string) bool {
+	version = strings.TrimPrefix(version, "v")
+	return strings.HasPrefix(version, "5.") && !strings.Contains(version, "-")
 }
 
-// UnpackBepInEx unpacks the BepInEx zip into the specified directory.
+// UnpackBepInEx unpacks the newest cached BepInEx into the specified directory.
 func UnpackBepInEx(targetDir string) error {
-	zipPath := filepath.Join(filesystem.GetDefaultPath(), bepInExCacheDir, "BepInEx.zip")
+	zipPath, err := defaultBepInExZip(filesystem.GetDefaultPath())
+	if err != nil {
+		return err
+	}
 
-	r, err := zip.OpenReader(zipPath)
+	return unpackBepInExZip(zipPath, targetDir, nil)
+}
+
+// installBepInExArchive installs BepInEx/core and the loader files of a BepInEx archive
+// into the profile, replacing the installed ones. Config files are only added when the
+// profile doesn't have them yet. Files are looked up below prefix inside the archive.
+func installBepInExArchive(profilePath, zipPath, prefix string) error {
+	coreDir := filepath.Join(profilePath, "BepInEx", "core")
+
+	// Stage in the cache, which is next to the profiles, so the staged files can be
+	// renamed into the profile. It is never listed as a profile.
+	stagingRoot := filepath.Join(filesystem.GetDefaultPath(), bepInExCacheDir)
+	if err := os.MkdirAll(stagingRoot, 0755); err != nil {
+		return err
+	}
+	removeStaleBepInExStaging(stagingRoot)
+	stagingDir, err := os.MkdirTemp(stagingRoot, bepInExStagingPrefix+"*")
 	if err != nil {
 		return err
 	}
-	defer r.Close()
+	keepStaging := false
+	defer func() {
+		if !keepStaging {
+			os.RemoveAll(stagingDir)
+		}
+	}()
 
-	for _, f := range r.File {
-		rc, err := f.Open()
-		if err != nil {
+	// Unpack into a staging directory first, so a broken archive leaves the profile untouched.
+	include := func(name string) (string, bool) {
+		if !strings.HasPrefix(name, prefix) {
+			return "", false
+		}
+		name = strings.TrimPrefix(name, prefix)
+		if strings.HasPrefix(name, "BepInEx/core/") {
+			return name, true
+		}
+		for _, file := range append(bepInExRootFiles, bepInExDefaultFiles...) {
+			if name == file {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	if err := unpackBepInExZip(zipPath, stagingDir, include); err != nil {
+		return fmt.Errorf("error unpacking BepInEx: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(stagingDir, "BepInEx", "core")); err != nil {
+		return fmt.Errorf("%s has no BepInEx core directory", filepath.Base(zipPath))
+	}
+
+	// Move the installed core aside instead of deleting it, so it can be put back
+	// when the new one can't be moved into place. It is removed with the staging directory.
+	backupDir := filepath.Join(stagingDir, "core-backup")
+	hasBackup := false
+	if _, err := os.Stat(coreDir); err == nil {
+		if err := os.Rename(coreDir, backupDir); err != nil {
 			return err
 		}
-		defer rc.Close()
+		hasBackup = true
+	} else if !os.IsNotExist(err) {
+		return err
+	}
 
-		fpath := filepath.Join(targetDir, f.Name)
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
-		} else {
-			var fdir string
-			if lastIndex := strings.LastIndex(fpath, string(os.PathSeparator)); lastIndex > -1 {
-				fdir = fpath[:lastIndex]
+	err = os.MkdirAll(filepath.Dir(coreDir), 0755)
+	if err == nil {
+		err = os.Rename(filepath.Join(stagingDir, "BepInEx", "core"), coreDir)
+	}
+	if err != nil {
+		if hasBackup {
+			if restoreErr := os.Rename(backupDir, coreDir); restoreErr != nil {
+				keepStaging = true
+				return fmt.Errorf("error replacing BepInEx core: %w (restoring the old core failed: %v, it is kept in %s)", err, restoreErr, backupDir)
 			}
+		}
+		return fmt.Errorf("error replacing BepInEx core: %w", err)
+	}
 
-			err = os.MkdirAll(fdir, os.ModePerm)
-			if err != nil {
-				log.Fatal(err)
-				return err
-			}
-			f, err := os.OpenFile(
-				fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				return err
+	for _, file := range bepInExRootFiles {
+		stagedPath := filepath.Join(stagingDir, file)
+		if _, err := os.Stat(stagedPath); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(stagedPath, filepath.Join(profilePath, file)); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range bepInExDefaultFiles {
+		stagedPath := filepath.Join(stagingDir, filepath.FromSlash(file))
+		targetPath := filepath.Join(profilePath, filepath.FromSlash(file))
+		if _, err := os.Stat(stagedPath); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(targetPath); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(stagedPath, targetPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeStaleBepInExStaging removes staging directories older installs left behind when they were interrupted.
+func removeStaleBepInExStaging(stagingRoot string) {
+	stale, _ := filepath.Glob(filepath.Join(stagingRoot, bepInExStagingPrefix+"*"))
+	for _, dir := range stale {
+		if info, err := os.Stat(dir); err == nil && time.Since(info.ModTime()) > time.Hour {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+// InstalledBepInExVersion reads the version of BepInEx installed in a profile from BepInEx.dll.
+func InstalledBepInExVersion(profilePath string) (string, error) {
+	info, err := assembly.ReadFile(filepath.Join(profilePath, "BepInEx", "core", "BepInEx.dll"))
+	if err != nil {
+		return "", fmt.Errorf("error reading BepInEx version: %w", err)
+	}
+
+	return info.Version, nil
+}
+
+// unpackBepInExZip unpacks the archive into targetDir. When include is set,
+// only the files it accepts are unpacked, to the path it returns.
+func unpackBepInExZip(zipPath, targetDir string, include func(name string) (string, bool)) error {
+	// Check the whole archive first, so a broken one doesn't half-extract.
+	if err := api.VerifyDownload(zipPath, filepath.Base(zipPath), api.ExpectedFile{}); err != nil {
+		return err
+	}
+
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		if include != nil {
+			var ok bool
+			if name, ok = include(name); !ok {
+				continue
 			}
-			defer f.Close()
+		}
+
+		fpath := filepath.Join(targetDir, filepath.FromSlash(name))
+		if !strings.HasPrefix(fpath, filepath.Clean(targetDir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid file path in BepInEx archive: %s", f.Name)
+		}
 
-			_, err = io.Copy(f, rc)
-			if err != nil {
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
 				return err
 			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+			return err
+		}
+		if err := unpackZipFile(f, fpath); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// unpackZipFile writes a single archive entry to path.
+func unpackZipFile(f *zip.File, path string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, rc)
+	return err
+}
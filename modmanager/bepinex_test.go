@@ -0,0 +1,89 @@
+package modmanager
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// writeBepInExArchive writes a BepInExPack-style archive with the given files below BepInExPack/.
+func writeBepInExArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	zipPath := filepath.Join(t.TempDir(), "BepInExPack.zip")
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for name, content := range files {
+		f, err := w.Create(bepInExPackDir + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func TestInstallBepInExArchive(t *testing.T) {
+	pluginsDir := setupProfile(t, "Main")
+	profilePath := filepath.Dir(filepath.Dir(pluginsDir))
+	writeFiles(t, profilePath, map[string]string{
+		"BepInEx/core/Old.dll":       "old",
+		"BepInEx/config/BepInEx.cfg": "edited",
+	})
+
+	zipPath := writeBepInExArchive(t, map[string]string{
+		"BepInEx/core/BepInEx.Preloader.dll": "new",
+		"BepInEx/config/BepInEx.cfg":         "default",
+		"winhttp.dll":                        "proxy",
+		"doorstop_config.ini":                "[General]\n",
+	})
+	if err := installBepInExArchive(profilePath, zipPath, bepInExPackDir+"/"); err != nil {
+		t.Fatalf("installBepInExArchive() failed: %v", err)
+	}
+
+	for file, want := range map[string]string{
+		"BepInEx/core/BepInEx.Preloader.dll": "new",
+		"BepInEx/config/BepInEx.cfg":         "edited",
+		"winhttp.dll":                        "proxy",
+		"doorstop_config.ini":                "[General]\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(profilePath, filepath.FromSlash(file)))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", file, got, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(profilePath, "BepInEx", "core", "Old.dll")); !os.IsNotExist(err) {
+		t.Error("the old core was not replaced")
+	}
+	staging, _ := filepath.Glob(filepath.Join(filesystem.GetDefaultPath(), bepInExCacheDir, bepInExStagingPrefix+"*"))
+	if len(staging) != 0 {
+		t.Errorf("the staging directory and the old core backup were not removed: %v", staging)
+	}
+}
+
+func TestInstallBepInExArchiveWithoutCore(t *testing.T) {
+	pluginsDir := setupProfile(t, "Main")
+	profilePath := filepath.Dir(filepath.Dir(pluginsDir))
+	writeFiles(t, profilePath, map[string]string{"BepInEx/core/BepInEx.Preloader.dll": "old"})
+
+	zipPath := writeBepInExArchive(t, map[string]string{"winhttp.dll": "proxy"})
+	if err := installBepInExArchive(profilePath, zipPath, bepInExPackDir+"/"); err == nil {
+		t.Fatal("installBepInExArchive() installed an archive without a core")
+	}
+
+	if got, err := os.ReadFile(filepath.Join(profilePath, "BepInEx", "core", "BepInEx.Preloader.dll")); err != nil || string(got) != "old" {
+		t.Errorf("the installed core changed: %q, %v", got, err)
+	}
+}
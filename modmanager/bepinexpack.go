@@ -0,0 +1,119 @@
+package modmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/api"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// The Thunderstore package Lethal Company mods depend on for BepInEx.
+// It wraps a BepInEx 5 release together with a preconfigured BepInEx.cfg.
+const (
+	BepInExPackAuthor = "BepInEx"
+	BepInExPackName   = "BepInExPack"
+)
+
+// bepInExPackDir is the directory inside the package that holds the BepInEx installation.
+const bepInExPackDir = "BepInExPack"
+
+// bepInExPackPrefix starts the file names of the BepInExPack versions in the package cache.
+const bepInExPackPrefix = BepInExPackAuthor + "-" + BepInExPackName + "-"
+
+// BepInExPackCachePath returns where the package of the version is cached.
+func BepInExPackCachePath(basePath, version string) string {
+	return filepath.Join(basePath, bepInExCacheDir, api.PackagesCacheDir, bepInExPackPrefix+version+".zip")
+}
+
+// DeclaredBepInExPackVersion returns the highest BepInExPack version the mods depend on,
+// or an empty string if none of them declare it.
+func DeclaredBepInExPackVersion(mods []ModDetails) string {
+	var version string
+	for _, mod := range mods {
+		for _, dep := range mod.Manifest.Dependencies {
+			parts := strings.Split(dep, "-")
+			if len(parts) != 3 || parts[0] != BepInExPackAuthor || parts[1] != BepInExPackName {
+				continue
+			}
+			if version == "" || CompareVersions(parts[2], version) > 0 {
+				version = parts[2]
+			}
+		}
+	}
+
+	return version
+}
+
+// ResolveBepInExPackVersion returns the BepInExPack version the mods of the profile need.
+// Without any declarations the latest version on Thunderstore is used, or the newest
+// cached one when Thunderstore can't be reached.
+func ResolveBepInExPackVersion(profileName string) (string, error) {
+	mods, err := ListMods(profileName)
+	if err != nil {
+		return "", err
+	}
+
+	if version := DeclaredBepInExPackVersion(mods); version != "" {
+		return version, nil
+	}
+
+	modInfo, err := api.FetchModDetails(BepInExPackAuthor, BepInExPackName)
+	if err == nil {
+		return modInfo.LatestVersion, nil
+	}
+
+	cached, cacheErr := ListCachedBepInExPacks(filesystem.GetDefaultPath())
+	if cacheErr != nil || len(cached) == 0 {
+		return "", fmt.Errorf("error getting latest BepInExPack version: %w", err)
+	}
+	return cached[0], nil
+}
+
+// CacheBepInExPack makes sure the version of the package is cached and returns the cached zip.
+func CacheBepInExPack(basePath, version string) (string, error) {
+	zipPath := BepInExPackCachePath(basePath, version)
+	if isCachedArchiveValid(zipPath) {
+		return zipPath, nil
+	}
+
+	zipName, err := api.DownloadModPackage(BepInExPackAuthor, BepInExPackName, version)
+	if err != nil {
+		return "", fmt.Errorf("error downloading BepInExPack: %w", err)
+	}
+
+	return zipName, nil
+}
+
+// ListCachedBepInExPacks lists the cached BepInExPack versions, newest first.
+func ListCachedBepInExPacks(basePath string) ([]string, error) {
+	archives, err := filepath.Glob(filepath.Join(basePath, bepInExCacheDir, api.PackagesCacheDir, bepInExPackPrefix+"*.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, archive := range archives {
+		versions = append(versions, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(archive), bepInExPackPrefix), ".zip"))
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) > 0
+	})
+
+	return versions, nil
+}
+
+// InstallBepInExPack installs a version of the BepInExPack package into the profile directory.
+// BepInEx/core and the loader files are replaced; the preconfigured BepInEx.cfg and the
+// Doorstop config are only added if the profile doesn't have them yet.
+func InstallBepInExPack(profilePath, version string) error {
+	zipPath, err := CacheBepInExPack(filesystem.GetDefaultPath(), version)
+	if err != nil {
+		return err
+	}
+
+	return installBepInExArchive(profilePath, zipPath, bepInExPackDir+"/")
+}
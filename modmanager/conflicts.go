@@ -0,0 +1,369 @@
+package modmanager
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/The-Lethal-Foundation/lethal-core/assembly"
+)
+
+type ConflictKind string
+
+const (
+	FileConflict     ConflictKind = "file"
+	GUIDConflict     ConflictKind = "guid"
+	AssemblyConflict ConflictKind = "assembly"
+)
+
+// Conflict is a shared file, plugin GUID or assembly name shipped by more than one package.
+type Conflict struct {
+	Kind        ConflictKind `json:"kind"`
+	Key         string       `json:"key"`
+	ModDirNames []string     `json:"mod_dir_names"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s conflict on %s between %s", c.Kind, c.Key, strings.Join(c.ModDirNames, ", "))
+}
+
+type ConflictPolicy int
+
+const (
+	// ConflictWarn logs conflicts and installs anyway.
+	ConflictWarn ConflictPolicy = iota
+	// ConflictRefuse aborts an install that would conflict with another package.
+	ConflictRefuse
+	// ConflictIgnore installs without checking for conflicts.
+	ConflictIgnore
+)
+
+// InstallConflictPolicy decides what installs do when a package conflicts with an installed one.
+var InstallConflictPolicy = ConflictWarn
+
+// ConflictError is returned when an install is refused because of conflicts.
+type ConflictError struct {
+	ModDirName string
+	Conflicts  []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s conflicts with installed packages: %d conflict(s), first: %s", e.ModDirName, len(e.Conflicts), e.Conflicts[0])
+}
+
+// packageMetadataFiles are shipped by every Thunderstore package and never conflict,
+// wherever they are in the package.
+var packageMetadataFiles = map[string]bool{
+	"manifest.json": true,
+	"icon.png":      true,
+	"readme.md":     true,
+	"changelog.md":  true,
+	"license":       true,
+	"license.md":    true,
+	"license.txt":   true,
+}
+
+// sharedDirs are the BepInEx directories the files packages ship for them are merged
+// into. Files anywhere else stay inside the package's own plugins directory.
+var sharedDirs = []string{"patchers", "core", "config"}
+
+// AnalyzeConflicts reports overlapping shared files, duplicate plugin GUIDs and duplicate
+// assembly names between the packages installed in the profile. Other versions of the
+// same package are not reported against each other.
+func AnalyzeConflicts(profileName string) ([]Conflict, error) {
+	entries, err := indexProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]string{}
+	guids := map[string][]string{}
+	assemblies := map[string][]string{}
+	for modDirName, entry := range entries {
+		addOwner(files, entry.files, modDirName)
+		addOwner(guids, entry.guids, modDirName)
+		addOwner(assemblies, entry.assemblies, modDirName)
+	}
+
+	var conflicts []Conflict
+	conflicts = append(conflicts, collectConflicts(FileConflict, files)...)
+	conflicts = append(conflicts, collectConflicts(GUIDConflict, guids)...)
+	conflicts = append(conflicts, collectConflicts(AssemblyConflict, assemblies)...)
+	return conflicts, nil
+}
+
+// conflictsOf compares the keys of one package against the other indexed packages.
+func conflictsOf(modDirName string, target *packageIndexEntry, entries map[string]*packageIndexEntry) []Conflict {
+	files := ownersOf(target.files, modDirName)
+	guids := ownersOf(target.guids, modDirName)
+	assemblies := ownersOf(target.assemblies, modDirName)
+	for dirName, entry := range entries {
+		if dirName == modDirName {
+			continue
+		}
+		addKnownOwner(files, entry.files, dirName)
+		addKnownOwner(guids, entry.guids, dirName)
+		addKnownOwner(assemblies, entry.assemblies, dirName)
+	}
+
+	var conflicts []Conflict
+	conflicts = append(conflicts, collectConflicts(FileConflict, files)...)
+	conflicts = append(conflicts, collectConflicts(GUIDConflict, guids)...)
+	conflicts = append(conflicts, collectConflicts(AssemblyConflict, assemblies)...)
+	return conflicts
+}
+
+// checkInstallConflicts applies InstallConflictPolicy to a package extracted into modPath,
+// before it is moved into the profile. A failing scan is only logged, it never fails the install.
+func checkInstallConflicts(profileName, modDirName, modPath string) error {
+	if InstallConflictPolicy == ConflictIgnore {
+		return nil
+	}
+
+	files, fingerprint, err := fingerprintPackage(modPath)
+	if err != nil {
+		log.Printf("Warning: error checking %s for conflicts: %v\n", modDirName, err)
+		return nil
+	}
+	target, err := readPackageEntry(modPath, files, fingerprint)
+	if err != nil {
+		log.Printf("Warning: error checking %s for conflicts: %v\n", modDirName, err)
+		return nil
+	}
+	entries, err := indexProfile(profileName)
+	if err != nil {
+		log.Printf("Warning: error checking %s for conflicts: %v\n", modDirName, err)
+		return nil
+	}
+
+	conflicts := conflictsOf(modDirName, target, entries)
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	if InstallConflictPolicy == ConflictRefuse {
+		return &ConflictError{ModDirName: modDirName, Conflicts: conflicts}
+	}
+
+	for _, conflict := range conflicts {
+		log.Printf("Warning: %s\n", conflict)
+	}
+	return nil
+}
+
+// packageIndexEntry holds the keys of an installed package that can conflict.
+type packageIndexEntry struct {
+	// fingerprint identifies the files of the package the entry was built from.
+	fingerprint uint64
+	// files are the package's files in the shared directories, see sharedFileKey.
+	files      []string
+	guids      []string
+	assemblies []string
+}
+
+// packageIndex caches the entries of installed packages by their path. Listing the
+// files of a package is cheap, parsing its assemblies isn't, so entries are only
+// rebuilt when the files of the package changed.
+var packageIndex = struct {
+	sync.Mutex
+	entries map[string]*packageIndexEntry
+}{entries: map[string]*packageIndexEntry{}}
+
+// indexProfile returns the index entries of the packages installed in the profile by
+// their directory name. Packages that can't be read are logged and left out.
+func indexProfile(profileName string) (map[string]*packageIndexEntry, error) {
+	pluginsDir := profilePluginsDir(profileName)
+
+	mods, err := ListMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]*packageIndexEntry{}
+	for _, mod := range mods {
+		entry, err := indexPackage(filepath.Join(pluginsDir, mod.ModDirName))
+		if err != nil {
+			log.Printf("Skipping %s in conflict analysis: %v\n", mod.ModDirName, err)
+			continue
+		}
+		entries[mod.ModDirName] = entry
+	}
+	return entries, nil
+}
+
+// indexPackage returns the index entry of the package, from the cache if its files didn't change.
+func indexPackage(modPath string) (*packageIndexEntry, error) {
+	files, fingerprint, err := fingerprintPackage(modPath)
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %w", err)
+	}
+
+	packageIndex.Lock()
+	cached, ok := packageIndex.entries[modPath]
+	packageIndex.Unlock()
+	if ok && cached.fingerprint == fingerprint {
+		return cached, nil
+	}
+
+	entry, err := readPackageEntry(modPath, files, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	packageIndex.Lock()
+	packageIndex.entries[modPath] = entry
+	packageIndex.Unlock()
+	return entry, nil
+}
+
+// readPackageEntry builds the index entry of a package without caching it, for
+// packages that are not installed yet.
+func readPackageEntry(modPath string, files []string, fingerprint uint64) (*packageIndexEntry, error) {
+	infos, err := assembly.ReadDir(modPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading assemblies: %w", err)
+	}
+
+	entry := &packageIndexEntry{fingerprint: fingerprint, files: files}
+	for _, info := range infos {
+		entry.assemblies = append(entry.assemblies, info.Name)
+		for _, plugin := range info.Plugins {
+			entry.guids = append(entry.guids, plugin.GUID)
+		}
+	}
+	return entry, nil
+}
+
+// fingerprintPackage lists the enabled files the package ships for the shared directories
+// and hashes the path, size and modification time of every file in it.
+func fingerprintPackage(modPath string) ([]string, uint64, error) {
+	hash := fnv.New64a()
+	var files []string
+	err := filepath.WalkDir(modPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(modPath, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", relPath, info.Size(), info.ModTime().UnixNano())
+
+		if strings.HasSuffix(relPath, disabledSuffix) {
+			return nil
+		}
+		if key, ok := sharedFileKey(relPath); ok {
+			files = append(files, key)
+		}
+		return nil
+	})
+
+	return files, hash.Sum64(), err
+}
+
+// sharedFileKey returns where BepInEx merges a file of a package, as
+// "BepInEx/<shared dir>/<path>". Packages ship these files either below BepInEx/
+// or at their root. Package metadata files and files outside the shared
+// directories are not merged and report false.
+func sharedFileKey(relPath string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	if len(parts) > 2 && strings.EqualFold(parts[0], "BepInEx") {
+		parts = parts[1:]
+	}
+	if len(parts) < 2 || packageMetadataFiles[strings.ToLower(parts[len(parts)-1])] {
+		return "", false
+	}
+
+	for _, dir := range sharedDirs {
+		if strings.EqualFold(parts[0], dir) {
+			return "BepInEx/" + dir + "/" + strings.Join(parts[1:], "/"), true
+		}
+	}
+	return "", false
+}
+
+// addOwner records owner for every key.
+func addOwner(owners map[string][]string, keys []string, owner string) {
+	for _, key := range keys {
+		owners[key] = append(owners[key], owner)
+	}
+}
+
+// ownersOf starts an owners map with the keys of one package.
+func ownersOf(keys []string, owner string) map[string][]string {
+	owners := map[string][]string{}
+	addOwner(owners, keys, owner)
+	return owners
+}
+
+// addKnownOwner records owner for the keys that are already in the map.
+func addKnownOwner(owners map[string][]string, keys []string, owner string) {
+	for _, key := range keys {
+		if _, ok := owners[key]; ok {
+			owners[key] = append(owners[key], owner)
+		}
+	}
+}
+
+// collectConflicts turns a key to packages map into conflicts, keeping only
+// keys shared by at least two different packages.
+func collectConflicts(kind ConflictKind, owners map[string][]string) []Conflict {
+	var conflicts []Conflict
+	for key, dirNames := range owners {
+		packages := map[string]bool{}
+		for _, dirName := range dirNames {
+			packages[packageId(dirName)] = true
+		}
+		if len(packages) < 2 {
+			continue
+		}
+
+		sort.Strings(dirNames)
+		conflicts = append(conflicts, Conflict{Kind: kind, Key: key, ModDirNames: dirNames})
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Key < conflicts[j].Key
+	})
+	return conflicts
+}
+
+// packageFiles lists the files of an extracted package relative to its directory,
+// leaving out the Thunderstore metadata files at its root.
+func packageFiles(modPath string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(modPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(modPath, path)
+		if err != nil {
+			return err
+		}
+		if !strings.ContainsRune(relPath, filepath.Separator) && packageMetadataFiles[strings.ToLower(relPath)] {
+			return nil
+		}
+
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+
+	return files, err
+}
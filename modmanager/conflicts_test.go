@@ -0,0 +1,167 @@
+package modmanager
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/The-Lethal-Foundation/lethal-core/api"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// setupProfile points the default path at a temporary directory, creates the
+// profile in it and returns the profile's plugins directory.
+func setupProfile(t *testing.T, profileName string) string {
+	t.Helper()
+	basePath := t.TempDir()
+	getDefaultPath := filesystem.GetDefaultPath
+	filesystem.GetDefaultPath = func() string { return basePath }
+	t.Cleanup(func() { filesystem.GetDefaultPath = getDefaultPath })
+
+	pluginsDir := filepath.Join(basePath, "LethalCompany", "Profiles", profileName, "BepInEx", "plugins")
+	if err := os.MkdirAll(pluginsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return pluginsDir
+}
+
+// testPackageFiles returns the files of a test package with the given extra files.
+func testPackageFiles(name string, files ...string) map[string]string {
+	contents := map[string]string{
+		"manifest.json": `{"name": "` + name + `", "version_number": "1.0.0"}`,
+		"icon.png":      "",
+		"README.md":     "# " + name,
+	}
+	for _, file := range files {
+		contents[file] = name
+	}
+	return contents
+}
+
+// writeFiles writes the files, by their slash separated paths, into dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeCachedPackage puts a package zip into the package cache and switches to
+// offline mode, so installs use it without downloading.
+func writeCachedPackage(t *testing.T, author, name, version string, files map[string]string) {
+	t.Helper()
+	api.SetOffline(true)
+	t.Cleanup(func() { api.SetOffline(false) })
+
+	zipPath := api.PackageCachePath(author, name, version)
+	if err := os.MkdirAll(filepath.Dir(zipPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedFileKey(t *testing.T) {
+	tests := []struct {
+		relPath string
+		key     string
+		shared  bool
+	}{
+		{"config/Mimics.cfg", "BepInEx/config/Mimics.cfg", true},
+		{"BepInEx/config/Mimics.cfg", "BepInEx/config/Mimics.cfg", true},
+		{"patchers/Mimics/Patcher.dll", "BepInEx/patchers/Mimics/Patcher.dll", true},
+		{"BepInEx/Core/0Harmony.dll", "BepInEx/core/0Harmony.dll", true},
+		{"patchers/README.md", "", false},
+		{"manifest.json", "", false},
+		{"Mimics.dll", "", false},
+		{"assets/config/Mimics.cfg", "", false},
+		{"BepInEx/plugins/Mimics.dll", "", false},
+	}
+
+	for _, test := range tests {
+		key, shared := sharedFileKey(filepath.FromSlash(test.relPath))
+		if key != test.key || shared != test.shared {
+			t.Errorf("sharedFileKey(%q) = %q, %v, want %q, %v", test.relPath, key, shared, test.key, test.shared)
+		}
+	}
+}
+
+func TestAnalyzeConflicts(t *testing.T) {
+	pluginsDir := setupProfile(t, "Main")
+	// Every package ships metadata and a root Plugin.txt, which BepInEx never merges.
+	writeFiles(t, filepath.Join(pluginsDir, "x753-A-1.0.0"), testPackageFiles("A", "Plugin.txt", "config/Shared.cfg", "BepInEx/patchers/Patcher.txt"))
+	writeFiles(t, filepath.Join(pluginsDir, "x753-B-1.0.0"), testPackageFiles("B", "Plugin.txt", "BepInEx/config/Shared.cfg", "patchers/Patcher.txt"))
+	writeFiles(t, filepath.Join(pluginsDir, "x753-C-1.0.0"), testPackageFiles("C", "Plugin.txt", "config/C.cfg"))
+	// Another version of the same package doesn't conflict with it.
+	writeFiles(t, filepath.Join(pluginsDir, "x753-C-2.0.0"), testPackageFiles("C", "Plugin.txt", "config/C.cfg"))
+
+	conflicts, err := AnalyzeConflicts("Main")
+	if err != nil {
+		t.Fatalf("AnalyzeConflicts() failed: %v", err)
+	}
+	want := []Conflict{
+		{Kind: FileConflict, Key: "BepInEx/config/Shared.cfg", ModDirNames: []string{"x753-A-1.0.0", "x753-B-1.0.0"}},
+		{Kind: FileConflict, Key: "BepInEx/patchers/Patcher.txt", ModDirNames: []string{"x753-A-1.0.0", "x753-B-1.0.0"}},
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("AnalyzeConflicts() = %v, want %v", conflicts, want)
+	}
+}
+
+func TestInstallRefusesConflicts(t *testing.T) {
+	pluginsDir := setupProfile(t, "Main")
+	policy := InstallConflictPolicy
+	InstallConflictPolicy = ConflictRefuse
+	t.Cleanup(func() { InstallConflictPolicy = policy })
+
+	writeFiles(t, filepath.Join(pluginsDir, "x753-A-1.0.0"), testPackageFiles("A", "config/Shared.cfg"))
+	// B is already installed and valid, reinstalling it is refused because of A.
+	writeFiles(t, filepath.Join(pluginsDir, "x753-B-1.0.0"), testPackageFiles("B", "B.txt"))
+	writeCachedPackage(t, "x753", "B", "1.0.0", testPackageFiles("B", "B.txt", "config/Shared.cfg"))
+
+	err := InstallModVersion("Main", "x753", "B", "1.0.0", false)
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 1 || conflictErr.Conflicts[0].Key != "BepInEx/config/Shared.cfg" {
+		t.Fatalf("InstallModVersion() error = %v, want a conflict on BepInEx/config/Shared.cfg", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(pluginsDir, "x753-B-1.0.0", "B.txt")); err != nil {
+		t.Errorf("the refused install removed the installed package: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pluginsDir, "x753-B-1.0.0", "config")); !os.IsNotExist(err) {
+		t.Error("the refused package was extracted into the profile")
+	}
+	if _, err := os.Stat(filepath.Join(pluginsDir, "x753-A-1.0.0", "config", "Shared.cfg")); err != nil {
+		t.Errorf("the conflicting package was changed: %v", err)
+	}
+	staging, _ := filepath.Glob(filepath.Join(filesystem.GetDefaultPath(), filesystem.DefaultCacheDir, installStagingPrefix+"*"))
+	if len(staging) != 0 {
+		t.Errorf("the staging directory was not removed: %v", staging)
+	}
+}
@@ -0,0 +1,67 @@
+package modmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// disabledSuffix is appended to the files of a disabled mod, the same way r2modman does it,
+// so BepInEx no longer picks up its dlls.
+const disabledSuffix = ".old"
+
+// EnableMod enables a mod.
+func EnableMod(modName, profileName string) error {
+	return SetModDirEnabled(filepath.Join(profilePluginsDir(profileName), modName), true)
+}
+
+// DisableMod disables a mod.
+func DisableMod(modName, profileName string) error {
+	return SetModDirEnabled(filepath.Join(profilePluginsDir(profileName), modName), false)
+}
+
+// SetModDirEnabled enables or disables the mod extracted in modDirPath, which doesn't
+// have to be inside a profile yet.
+func SetModDirEnabled(modDirPath string, enabled bool) error {
+	action := "enabling"
+	if !enabled {
+		action = "disabling"
+	}
+
+	files, err := packageFiles(modDirPath)
+	if err != nil {
+		return fmt.Errorf("error %s mod: %w", action, err)
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file, disabledSuffix) == !enabled {
+			continue
+		}
+		path := filepath.Join(modDirPath, filepath.FromSlash(file))
+		target := path + disabledSuffix
+		if enabled {
+			target = strings.TrimSuffix(path, disabledSuffix)
+		}
+		if err := os.Rename(path, target); err != nil {
+			return fmt.Errorf("error %s mod: %w", action, err)
+		}
+	}
+
+	return nil
+}
+
+// isModEnabled reports whether the mod has any files that are not disabled.
+func isModEnabled(modDirPath string) (bool, error) {
+	files, err := packageFiles(modDirPath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file, disabledSuffix) {
+			return true, nil
+		}
+	}
+	return len(files) == 0, nil
+}
@@ -14,6 +14,9 @@ import (
 	"github.com/The-Lethal-Foundation/lethal-core/utils"
 )
 
+// installStagingPrefix starts the directories packages are extracted into inside the cache dir.
+const installStagingPrefix = "install-staging-"
+
 type ModManifest struct {
 	Name         string   `json:"name"`
 	Version      string   `json:"version_number"`
@@ -25,6 +28,7 @@ type ModDetails struct {
 	Author     string      `json:"author"`
 	ModDirName string      `json:"mod_dir_name"`
 	Manifest   ModManifest `json:"manifest"`
+	Enabled    bool        `json:"enabled"`
 }
 
 func InstallModFromUrl(profile, modUrl string) error {
@@ -66,41 +70,107 @@ func InstallMod(profileName, modAuthor, modTitle string) error {
 		return nil
 	}
 
-	// Download the mod to a temporary folder.
-	zipName, err := api.DownloadModPackage(modAuthor, modTitle, modVersion)
-	if err != nil {
-		return fmt.Errorf("error downloading mod: %w", err)
-	}
+	return InstallModVersion(profileName, modAuthor, modTitle, modVersion, true)
+}
 
+// profilePluginsDir returns the BepInEx plugins directory of the profile, which
+// holds one directory per installed package.
+func profilePluginsDir(profileName string) string {
+	return filepath.Join(filesystem.ProfilePath(profileName), "BepInEx", "plugins")
+}
+
+// InstallModVersion installs a specific version of the mod in the given profile.
+// Dependencies are only installed when withDependencies is set.
+func InstallModVersion(profileName, modAuthor, modTitle, modVersion string, withDependencies bool) error {
 	// Unzip the mod to the profile folder.
-	finalModPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", "profiles", profileName, "BepInEx", "plugins", fmt.Sprintf("%s-%s-%s", modAuthor, modTitle, modVersion))
-	err = UnzipMod(zipName, finalModPath)
-	if err != nil {
-		return fmt.Errorf("error unzipping mod: %w", err)
+	modDirName := fmt.Sprintf("%s-%s-%s", modAuthor, modTitle, modVersion)
+	finalModPath := filepath.Join(profilePluginsDir(profileName), modDirName)
+	if err := extractIntoProfile(profileName, modAuthor, modTitle, modVersion, finalModPath); err != nil {
+		return err
+	}
+
+	if !withDependencies {
+		return nil
 	}
 
 	// Read the mod manifest.
 	var modDetails ModDetails
 	modDetails.Author = modAuthor
 
-	manifestPath := filepath.Join(finalModPath, "manifest.json")
-	modDetails.Manifest, err = ReadModManifest(manifestPath)
+	manifest, err := ReadModManifest(filepath.Join(finalModPath, "manifest.json"))
 	if err != nil {
 		return fmt.Errorf("error reading mod manifest: %w", err)
 	}
+	modDetails.Manifest = manifest
 
 	// Install or update dependencies.
 	return installDependencies(profileName, modDetails)
 }
 
+// ExtractModVersion downloads a specific version of the mod and extracts it into
+// modPath, through the shared store when it is used. Dependencies are not installed.
+func ExtractModVersion(modAuthor, modTitle, modVersion, modPath string) error {
+	// Download the mod to a temporary folder.
+	zipName, err := api.DownloadModPackage(modAuthor, modTitle, modVersion)
+	if err != nil {
+		return fmt.Errorf("error downloading mod: %w", err)
+	}
+
+	modDirName := fmt.Sprintf("%s-%s-%s", modAuthor, modTitle, modVersion)
+	if UseSharedStore {
+		err = installFromStore(zipName, modDirName, modPath)
+	} else {
+		err = UnzipMod(zipName, modPath)
+	}
+	if err != nil {
+		return fmt.Errorf("error unzipping mod: %w", err)
+	}
+	return nil
+}
+
+// extractIntoProfile extracts the mod into a staging directory, checks it for conflicts
+// with the installed packages and only then replaces modPath with it, so a refused
+// install leaves the profile untouched.
+func extractIntoProfile(profileName, modAuthor, modTitle, modVersion, modPath string) error {
+	// Stage in the cache, which is next to the profiles, so the package can be renamed into place.
+	stagingRoot := filepath.Join(filesystem.GetDefaultPath(), filesystem.DefaultCacheDir)
+	if err := os.MkdirAll(stagingRoot, 0755); err != nil {
+		return err
+	}
+	stagingDir, err := os.MkdirTemp(stagingRoot, installStagingPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	stagedPath := filepath.Join(stagingDir, filepath.Base(modPath))
+	if err := ExtractModVersion(modAuthor, modTitle, modVersion, stagedPath); err != nil {
+		return err
+	}
+
+	// Warn about or refuse packages that overwrite other packages' files.
+	if err := checkInstallConflicts(profileName, filepath.Base(modPath), stagedPath); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(modPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(modPath), 0755); err != nil {
+		return err
+	}
+	return os.Rename(stagedPath, modPath)
+}
+
 // installDependencies handles the installation or updating of mod dependencies.
 func installDependencies(profileName string, mod ModDetails) error {
+	var packages []api.PackageRef
 	for _, dep := range mod.Manifest.Dependencies {
 
 		// Split dep into modAuthor and modName and modVersion.
 		depSplit := strings.Split(dep, "-")
 
-		// Skip the dependency if it's BepInEx.
+		// Skip the dependency if it's BepInEx, it's installed per profile from the declared BepInExPack.
 		if depSplit[0] == "BepInEx" {
 			continue
 		}
@@ -109,7 +179,29 @@ func installDependencies(profileName string, mod ModDetails) error {
 			return fmt.Errorf("invalid dependency format: %s", dep)
 		}
 
-		if err := InstallMod(profileName, depSplit[0], depSplit[1]); err != nil {
+		// Dependencies are installed in their latest version.
+		modInfo, err := api.FetchModDetails(depSplit[0], depSplit[1])
+		if err != nil {
+			return fmt.Errorf("error getting dependency info: %w", err)
+		}
+		packages = append(packages, api.PackageRef{Author: depSplit[0], Name: depSplit[1], Version: modInfo.LatestVersion})
+	}
+
+	// Download all dependencies in parallel, installing them below only hits the package cache.
+	if err := api.DownloadModPackages(packages); err != nil {
+		return fmt.Errorf("error downloading dependencies: %w", err)
+	}
+
+	for _, pkg := range packages {
+		exists, err := isLocalModExists(profileName, pkg.Author, pkg.Name, pkg.Version)
+		if err != nil {
+			return fmt.Errorf("error checking if mod exists: %w", err)
+		}
+		if exists {
+			continue
+		}
+
+		if err := InstallModVersion(profileName, pkg.Author, pkg.Name, pkg.Version, true); err != nil {
 			return fmt.Errorf("error installing dependency: %w", err)
 		}
 	}
@@ -118,7 +210,7 @@ func installDependencies(profileName string, mod ModDetails) error {
 
 // isLocalModExists checks if the local mod exists in the specified profile.
 func isLocalModExists(profileName, modAuthor, modName, modVersion string) (bool, error) {
-	modPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", "Profiles", profileName, "BepInEx", "plugins", modName)
+	modPath := filepath.Join(profilePluginsDir(profileName), modName)
 
 	// Reading the directory content
 	files, err := os.ReadDir(modPath)
@@ -158,7 +250,7 @@ func isLocalModOutdated(profileName, modAuthor, modName, modVersion string) (boo
 // DeleteMod deletes a mod.
 func DeleteMod(profileName, modDirName string) error {
 
-	modDirPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", "Profiles", profileName, "BepInEx", "plugins", modDirName)
+	modDirPath := filepath.Join(profilePluginsDir(profileName), modDirName)
 
 	err := os.RemoveAll(modDirPath)
 	if err != nil {
@@ -168,24 +260,10 @@ func DeleteMod(profileName, modDirName string) error {
 	return nil
 }
 
-// EnableMod enables a mod.
-func EnableMod(modName, profileName string) error {
-	// Implementation for enabling a mod.
-
-	return nil
-}
-
-// DisableMod disables a mod.
-func DisableMod(modName, profileName string) error {
-	// Implementation for disabling a mod.
-
-	return nil
-}
-
 // ListMods returns a list of all mods.
 func ListMods(profileName string) ([]ModDetails, error) {
 
-	pluginsDir := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", "Profiles", profileName, "BepInEx", "plugins")
+	pluginsDir := profilePluginsDir(profileName)
 
 	// Reading the directory content
 	files, err := os.ReadDir(pluginsDir)
@@ -213,6 +291,10 @@ func ListMods(profileName string) ([]ModDetails, error) {
 					if err != nil {
 						return nil, fmt.Errorf("error reading mod manifest: %w", err)
 					}
+					modDetail.Enabled, err = isModEnabled(filepath.Join(pluginsDir, dirName))
+					if err != nil {
+						return nil, fmt.Errorf("error reading mod files: %w", err)
+					}
 					modDetails = append(modDetails, modDetail)
 				}
 			}
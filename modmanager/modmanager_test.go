@@ -0,0 +1,31 @@
+package modmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+func TestInstallModVersion(t *testing.T) {
+	setupProfile(t, "Main")
+	writeCachedPackage(t, "x753", "A", "1.0.0", testPackageFiles("A", "plugins/A.txt"))
+
+	if err := InstallModVersion("Main", "x753", "A", "1.0.0", false); err != nil {
+		t.Fatalf("InstallModVersion() failed: %v", err)
+	}
+
+	pluginPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", "Profiles", "Main", "BepInEx", "plugins", "x753-A-1.0.0", "A.txt")
+	if _, err := os.Stat(pluginPath); err != nil {
+		t.Errorf("the plugin was not installed into the profile: %v", err)
+	}
+
+	mods, err := ListMods("Main")
+	if err != nil {
+		t.Fatalf("ListMods() failed: %v", err)
+	}
+	if len(mods) != 1 || mods[0].ModDirName != "x753-A-1.0.0" || !mods[0].Enabled {
+		t.Errorf("ListMods() = %+v, want the installed package", mods)
+	}
+}
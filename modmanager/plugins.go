@@ -0,0 +1,149 @@
+package modmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/assembly"
+)
+
+// ModAssemblies holds the .NET assemblies found in an installed mod.
+type ModAssemblies struct {
+	ModDirName string          `json:"mod_dir_name"`
+	Assemblies []assembly.Info `json:"assemblies"`
+}
+
+// Plugins returns every BepInEx plugin declared by the mod's assemblies.
+func (m ModAssemblies) Plugins() []assembly.Plugin {
+	var plugins []assembly.Plugin
+	for _, info := range m.Assemblies {
+		plugins = append(plugins, info.Plugins...)
+	}
+	return plugins
+}
+
+// UndeclaredDependency is a hard [BepInDependency] of a mod's plugin that its
+// manifest does not declare, directly or through other dependencies.
+type UndeclaredDependency struct {
+	ModDirName string `json:"mod_dir_name"`
+	Plugin     string `json:"plugin"`
+	GUID       string `json:"guid"`
+	// ProvidedBy is the installed mod that ships the GUID, empty if none does.
+	ProvidedBy string `json:"provided_by"`
+}
+
+// ScanModAssemblies reads the plugin assemblies of an installed mod.
+func ScanModAssemblies(profileName, modDirName string) (*ModAssemblies, error) {
+	modPath := filepath.Join(profilePluginsDir(profileName), modDirName)
+
+	infos, err := assembly.ReadDir(modPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mod assemblies: %w", err)
+	}
+
+	return &ModAssemblies{ModDirName: modDirName, Assemblies: infos}, nil
+}
+
+// ScanProfileAssemblies reads the plugin assemblies of every mod in the profile.
+func ScanProfileAssemblies(profileName string) ([]ModAssemblies, error) {
+	mods, err := ListMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var scanned []ModAssemblies
+	for _, mod := range mods {
+		modAssemblies, err := ScanModAssemblies(profileName, mod.ModDirName)
+		if err != nil {
+			return nil, err
+		}
+		scanned = append(scanned, *modAssemblies)
+	}
+
+	return scanned, nil
+}
+
+// FindUndeclaredDependencies reports hard plugin dependencies that the mods'
+// manifests leave out, by comparing the [BepInDependency] attributes of their
+// assemblies against the manifest dependencies.
+func FindUndeclaredDependencies(profileName string) ([]UndeclaredDependency, error) {
+	mods, err := ListMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	scanned, err := ScanProfileAssemblies(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Map plugin GUIDs to the mod that ships them.
+	providers := map[string]string{}
+	for _, modAssemblies := range scanned {
+		for _, plugin := range modAssemblies.Plugins() {
+			providers[plugin.GUID] = modAssemblies.ModDirName
+		}
+	}
+
+	// Map package ids ("Author-Name") to their manifest dependencies.
+	manifestDependencies := map[string][]string{}
+	for _, mod := range mods {
+		id := packageId(mod.ModDirName)
+		for _, dep := range mod.Manifest.Dependencies {
+			manifestDependencies[id] = append(manifestDependencies[id], packageId(dep))
+		}
+	}
+
+	var undeclared []UndeclaredDependency
+	for _, modAssemblies := range scanned {
+		declared := declaredClosure(packageId(modAssemblies.ModDirName), manifestDependencies)
+
+		for _, plugin := range modAssemblies.Plugins() {
+			for _, dependency := range plugin.Dependencies {
+				if dependency.Soft {
+					continue
+				}
+
+				provider := providers[dependency.GUID]
+				if provider == modAssemblies.ModDirName || (provider != "" && declared[packageId(provider)]) {
+					continue
+				}
+
+				undeclared = append(undeclared, UndeclaredDependency{
+					ModDirName: modAssemblies.ModDirName,
+					Plugin:     plugin.GUID,
+					GUID:       dependency.GUID,
+					ProvidedBy: provider,
+				})
+			}
+		}
+	}
+
+	return undeclared, nil
+}
+
+// declaredClosure returns every package id reachable through the manifest dependencies of id.
+func declaredClosure(id string, manifestDependencies map[string][]string) map[string]bool {
+	declared := map[string]bool{}
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range manifestDependencies[current] {
+			if !declared[dep] {
+				declared[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return declared
+}
+
+// packageId strips the version from "Author-Name-Version", returning "Author-Name".
+func packageId(fullName string) string {
+	if index := strings.LastIndex(fullName, "-"); index > 0 && strings.Count(fullName, "-") >= 2 {
+		return fullName[:index]
+	}
+	return fullName
+}
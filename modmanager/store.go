@@ -0,0 +1,329 @@
+package modmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/api"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+)
+
+const StoreDirName = "Store"
+
+// UseSharedStore makes installs extract each package version once into the shared
+// store under the base path and hard-link it into profiles, instead of extracting
+// a full copy into every profile. A mod editing its own files in place changes the
+// store entry for every profile linked to it, see VerifyStore and RepairStoreEntry.
+var UseSharedStore = false
+
+// storeIndexSuffix is the suffix of the file recording the hashes of a store entry.
+const storeIndexSuffix = ".store.json"
+
+// storeIndex records the files of a store entry so in-place edits can be detected.
+type storeIndex struct {
+	Files map[string]storeFile `json:"files"`
+}
+
+type storeFile struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type StoreIssueKind string
+
+const (
+	StoreFileModified StoreIssueKind = "modified"
+	StoreFileMissing  StoreIssueKind = "missing"
+	StoreFileAdded    StoreIssueKind = "added"
+	StoreIndexMissing StoreIssueKind = "index-missing"
+)
+
+// StoreIssue is a file of a store entry that no longer matches what was extracted.
+type StoreIssue struct {
+	ModDirName string         `json:"mod_dir_name"`
+	File       string         `json:"file"`
+	Kind       StoreIssueKind `json:"kind"`
+}
+
+// storePath returns the directory of the store, or of an entry when modDirName is given.
+func storePath(modDirName string) string {
+	return filepath.Join(filesystem.GetDefaultPath(), StoreDirName, modDirName)
+}
+
+// installFromStore extracts the package zip into the store if this version is not
+// in it yet, then links the store entry into modPath.
+func installFromStore(zipName, modDirName, modPath string) error {
+	entryPath := storePath(modDirName)
+	if _, err := os.Stat(entryPath); os.IsNotExist(err) {
+		if err := addStoreEntry(zipName, modDirName); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return linkStoreEntry(modDirName, modPath)
+}
+
+// addStoreEntry extracts the package zip into the store and records its file hashes.
+func addStoreEntry(zipName, modDirName string) error {
+	entryPath := storePath(modDirName)
+
+	// Extract next to the final location first, so a failed extraction never leaves a half entry.
+	tmpPath := entryPath + ".tmp"
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return err
+	}
+	if err := UnzipMod(zipName, tmpPath); err != nil {
+		os.RemoveAll(tmpPath)
+		return err
+	}
+
+	index, err := hashStoreEntry(tmpPath)
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return err
+	}
+	indexFile, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFile(entryPath+storeIndexSuffix, indexFile, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, entryPath)
+}
+
+// linkStoreEntry hard-links every file of the store entry into modPath.
+// Files are copied when the store and the profile are on filesystems that can't link.
+func linkStoreEntry(modDirName, modPath string) error {
+	entryPath := storePath(modDirName)
+
+	return filepath.Walk(entryPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(entryPath, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(modPath, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return fileutil.LinkFile(path, target)
+	})
+}
+
+// hashStoreEntry hashes every file under entryPath.
+func hashStoreEntry(entryPath string) (*storeIndex, error) {
+	index := &storeIndex{Files: map[string]storeFile{}}
+	err := filepath.Walk(entryPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relPath, err := filepath.Rel(entryPath, path)
+		if err != nil {
+			return err
+		}
+
+		hash, err := fileutil.HashFile(path)
+		if err != nil {
+			return err
+		}
+		index.Files[filepath.ToSlash(relPath)] = storeFile{Size: info.Size(), SHA256: hash}
+		return nil
+	})
+
+	return index, err
+}
+
+// ListStoreEntries returns the package directory names in the store.
+func ListStoreEntries() ([]string, error) {
+	entries, err := os.ReadDir(storePath(""))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// StoreReferences counts which profiles use each store entry, by looking for the
+// package directory in every profile's plugins folder.
+func StoreReferences() (map[string][]string, error) {
+	entries, err := ListStoreEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	profilesPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", filesystem.ProfilesDirName)
+	profiles, err := os.ReadDir(profilesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	references := map[string][]string{}
+	for _, entry := range entries {
+		references[entry] = nil
+		for _, profile := range profiles {
+			if !profile.IsDir() {
+				continue
+			}
+			modPath := filepath.Join(profilesPath, profile.Name(), "BepInEx", "plugins", entry)
+			if _, err := os.Stat(modPath); err == nil {
+				references[entry] = append(references[entry], profile.Name())
+			}
+		}
+	}
+
+	return references, nil
+}
+
+// CollectStore removes the store entries no profile uses anymore and returns their names.
+func CollectStore() ([]string, error) {
+	references, err := StoreReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for entry, profiles := range references {
+		if len(profiles) > 0 {
+			continue
+		}
+		if err := os.RemoveAll(storePath(entry)); err != nil {
+			return removed, err
+		}
+		if err := os.Remove(storePath(entry) + storeIndexSuffix); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// VerifyStoreEntry compares the files of a store entry against the hashes recorded
+// when it was extracted. A mod that edits its own files in place changes the store
+// entry for every profile linked to it, which shows up here as modified files.
+func VerifyStoreEntry(modDirName string) ([]StoreIssue, error) {
+	indexFile, err := os.ReadFile(storePath(modDirName) + storeIndexSuffix)
+	if os.IsNotExist(err) {
+		return []StoreIssue{{ModDirName: modDirName, Kind: StoreIndexMissing}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var recorded storeIndex
+	if err := json.Unmarshal(indexFile, &recorded); err != nil {
+		return nil, fmt.Errorf("error unmarshaling store index: %w", err)
+	}
+
+	current, err := hashStoreEntry(storePath(modDirName))
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []StoreIssue
+	for file, want := range recorded.Files {
+		got, ok := current.Files[file]
+		if !ok {
+			issues = append(issues, StoreIssue{ModDirName: modDirName, File: file, Kind: StoreFileMissing})
+		} else if got != want {
+			issues = append(issues, StoreIssue{ModDirName: modDirName, File: file, Kind: StoreFileModified})
+		}
+	}
+	for file := range current.Files {
+		if _, ok := recorded.Files[file]; !ok {
+			issues = append(issues, StoreIssue{ModDirName: modDirName, File: file, Kind: StoreFileAdded})
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].File < issues[j].File
+	})
+	return issues, nil
+}
+
+// VerifyStore checks every store entry, see VerifyStoreEntry.
+func VerifyStore() ([]StoreIssue, error) {
+	entries, err := ListStoreEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []StoreIssue
+	for _, entry := range entries {
+		entryIssues, err := VerifyStoreEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, entryIssues...)
+	}
+	return issues, nil
+}
+
+// RepairStoreEntry downloads the package again, replaces the store entry with a
+// clean extraction and relinks it into every profile that uses it.
+func RepairStoreEntry(modDirName string) error {
+	parts := strings.Split(modDirName, "-")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid store entry name: %s", modDirName)
+	}
+
+	zipName, err := api.DownloadModPackage(parts[0], parts[1], parts[2])
+	if err != nil {
+		return fmt.Errorf("error downloading mod: %w", err)
+	}
+
+	references, err := StoreReferences()
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(storePath(modDirName)); err != nil {
+		return err
+	}
+	if err := addStoreEntry(zipName, modDirName); err != nil {
+		return err
+	}
+
+	for _, profile := range references[modDirName] {
+		modPath := filepath.Join(profilePluginsDir(profile), modDirName)
+		enabled, err := isModEnabled(modPath)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(modPath); err != nil {
+			return err
+		}
+		if err := linkStoreEntry(modDirName, modPath); err != nil {
+			return err
+		}
+		if !enabled {
+			if err := DisableMod(modDirName, profile); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
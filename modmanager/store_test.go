@@ -0,0 +1,47 @@
+package modmanager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInstallFromStoreLinksFiles(t *testing.T) {
+	setupProfile(t, "Main")
+	writeCachedPackage(t, "x753", "A", "1.0.0", testPackageFiles("A", "A.txt"))
+	modPath := filepath.Join(t.TempDir(), "x753-A-1.0.0")
+
+	useSharedStore := UseSharedStore
+	UseSharedStore = true
+	t.Cleanup(func() { UseSharedStore = useSharedStore })
+
+	if err := ExtractModVersion("x753", "A", "1.0.0", modPath); err != nil {
+		t.Fatalf("ExtractModVersion() failed: %v", err)
+	}
+
+	storeInfo, err := os.Stat(filepath.Join(storePath("x753-A-1.0.0"), "A.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(modPath, "A.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(storeInfo, info) {
+		t.Error("the installed file is not linked to the store entry")
+	}
+
+	// Editing the linked file in place changes the store entry.
+	if err := os.WriteFile(filepath.Join(modPath, "A.txt"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := VerifyStoreEntry("x753-A-1.0.0")
+	if err != nil {
+		t.Fatalf("VerifyStoreEntry() failed: %v", err)
+	}
+	want := []StoreIssue{{ModDirName: "x753-A-1.0.0", File: "A.txt", Kind: StoreFileModified}}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("VerifyStoreEntry() = %+v, want %+v", issues, want)
+	}
+}
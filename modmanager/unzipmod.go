@@ -160,6 +160,16 @@ func mergeDirs(srcDir, dstDir string) error {
 				return err
 			}
 		} else {
+			// Don't silently overwrite files another directory already placed here.
+			if _, err := os.Stat(dstPath); err == nil {
+				switch InstallConflictPolicy {
+				case ConflictRefuse:
+					return fmt.Errorf("refusing to overwrite existing file: %s", dstPath)
+				case ConflictWarn:
+					log.Printf("Warning: overwriting existing file: %s\n", dstPath)
+				}
+			}
+
 			// Move files
 			if err := os.Rename(srcPath, dstPath); err != nil {
 				return err
@@ -0,0 +1,9 @@
+package modmanager
+
+import "github.com/The-Lethal-Foundation/lethal-core/api"
+
+// CompareVersions compares two dotted version numbers like "5.4.2100".
+// It returns -1, 0 or 1. Missing parts count as 0 and non-numeric parts compare as text.
+func CompareVersions(a, b string) int {
+	return api.CompareVersions(a, b)
+}
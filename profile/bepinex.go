@@ -0,0 +1,88 @@
+package profile
+
+import (
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+)
+
+// BepInExVersion returns the BepInEx version installed in the profile.
+func BepInExVersion(profileName string) (string, error) {
+	if err := requireProfile(profileName); err != nil {
+		return "", err
+	}
+
+	return modmanager.InstalledBepInExVersion(profilePath(profileName))
+}
+
+// PinBepInEx pins the profile to a BepInExPack version and switches it to that version,
+// which can be an upgrade or a downgrade. Plugins and configs are kept.
+func PinBepInEx(profileName, version string) error {
+	if err := requireProfile(profileName); err != nil {
+		return err
+	}
+	if err := requireNotRunning(profileName); err != nil {
+		return err
+	}
+
+	if err := installProfileBepInEx(profileName, version); err != nil {
+		return err
+	}
+
+	return UpdateMetadata(profileName, func(metadata *Metadata) error {
+		metadata.PinnedBepInExPackVersion = version
+		return nil
+	})
+}
+
+// UnpinBepInEx removes the BepInEx pin of the profile. The installed version is kept
+// until the profile is upgraded.
+func UnpinBepInEx(profileName string) error {
+	if err := requireProfile(profileName); err != nil {
+		return err
+	}
+
+	return UpdateMetadata(profileName, func(metadata *Metadata) error {
+		metadata.PinnedBepInExPackVersion = ""
+		return nil
+	})
+}
+
+// UpgradeBepInEx switches the profile to its pinned BepInExPack version, or to the version
+// its mods declare. Plugins and configs are kept.
+func UpgradeBepInEx(profileName string) error {
+	if err := requireProfile(profileName); err != nil {
+		return err
+	}
+	if err := requireNotRunning(profileName); err != nil {
+		return err
+	}
+
+	return installProfileBepInEx(profileName, "")
+}
+
+// installProfileBepInEx installs a BepInExPack version into the profile and records it
+// in the metadata. Without a version, the pinned version or the one the mods declare is used.
+func installProfileBepInEx(profileName, version string) error {
+	metadata, err := GetMetadata(profileName)
+	if err != nil {
+		return err
+	}
+
+	if version == "" {
+		version = metadata.PinnedBepInExPackVersion
+	}
+	if version == "" {
+		version, err = modmanager.ResolveBepInExPackVersion(profileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := modmanager.InstallBepInExPack(profilePath(profileName), version); err != nil {
+		return err
+	}
+
+	return UpdateMetadata(profileName, func(metadata *Metadata) error {
+		metadata.BepInExPackVersion = version
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package profile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+)
+
+// CloneOptions controls what CloneProfile copies.
+type CloneOptions struct {
+	// SkipConfigs leaves out the mod configs in BepInEx/config. BepInEx.cfg is always copied.
+	SkipConfigs bool `json:"skip_configs"`
+	// SkipDisabledMods leaves out mods that are disabled in the source profile.
+	SkipDisabledMods bool `json:"skip_disabled_mods"`
+	// LinkPackages hard-links the BepInEx core and plugin files instead of copying
+	// them, so the profiles share their disk space. Editing a linked file in place
+	// changes it in every profile linked to it. Files are copied where the
+	// filesystem can't link them.
+	LinkPackages bool `json:"link_packages"`
+}
+
+// cloneSkippedFiles are per-run files that are never cloned. The sync link isn't cloned
+// either, only one profile is synced with an external profile.
+var cloneSkippedFiles = []string{
+	SyncFileName,
+	"BepInEx/LogOutput.log",
+	"instance-*.log",
+	"*" + fileutil.LockSuffix,
+}
+
+// CloneProfile duplicates the srcName profile with its mods, configs and settings as dstName.
+func CloneProfile(srcName, dstName string, opts CloneOptions) error {
+	if err := requireProfile(srcName); err != nil {
+		return err
+	}
+	if err := requireNewProfile(dstName, ""); err != nil {
+		return err
+	}
+
+	srcPath := profilePath(srcName)
+	dstPath := profilePath(dstName)
+
+	skippedMods := map[string]bool{}
+	if opts.SkipDisabledMods {
+		mods, err := modmanager.ListMods(srcName)
+		if err != nil {
+			return err
+		}
+		for _, mod := range mods {
+			if !mod.Enabled {
+				skippedMods[mod.ModDirName] = true
+			}
+		}
+	}
+
+	err := filepath.WalkDir(srcPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		slashPath := filepath.ToSlash(relPath)
+		target := filepath.Join(dstPath, relPath)
+
+		if entry.IsDir() {
+			if slashPath == SnapshotsDirName {
+				return filepath.SkipDir
+			}
+			if modDirName, ok := strings.CutPrefix(slashPath, "BepInEx/plugins/"); ok && skippedMods[modDirName] {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		}
+
+		if isSkippedCloneFile(slashPath) {
+			return nil
+		}
+		if opts.SkipConfigs && strings.HasPrefix(slashPath, "BepInEx/config/") && slashPath != "BepInEx/config/BepInEx.cfg" {
+			return nil
+		}
+
+		if opts.LinkPackages && (strings.HasPrefix(slashPath, "BepInEx/plugins/") || strings.HasPrefix(slashPath, "BepInEx/core/")) {
+			return fileutil.LinkFile(path, target)
+		}
+		return fileutil.CopyFile(path, target)
+	})
+	if err != nil {
+		os.RemoveAll(dstPath)
+		return fmt.Errorf("error cloning profile: %w", err)
+	}
+
+	metadata, err := GetMetadata(srcName)
+	if err != nil {
+		return err
+	}
+	metadata.DisplayName = dstName
+	metadata.CreatedAt = time.Now()
+	metadata.LastLaunchedAt = time.Time{}
+	metadata.Source = SourceCloned
+	metadata.SourceDetail = srcName
+	return SetMetadata(dstName, metadata)
+}
+
+func isSkippedCloneFile(slashPath string) bool {
+	for _, pattern := range cloneSkippedFiles {
+		if matched, _ := filepath.Match(pattern, slashPath); matched {
+			return true
+		}
+	}
+	return false
+}
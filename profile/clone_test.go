@@ -0,0 +1,44 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/The-Lethal-Foundation/lethal-core/external"
+)
+
+func TestCloneProfileLinkPackages(t *testing.T) {
+	a := external.Mod{Author: "x753", Name: "A", Version: "1.0.0", Enabled: true}
+	setupSync(t, a)
+	mustWriteFile(t, filepath.Join(configDir("Main"), "A.cfg"), "[General]\nEnabled = true\n")
+
+	if err := CloneProfile("Main", "Copy", CloneOptions{LinkPackages: true}); err != nil {
+		t.Fatalf("CloneProfile() failed: %v", err)
+	}
+
+	pluginPath := filepath.Join("BepInEx", "plugins", externalModDirName(a), "A.dll")
+	if !sameFile(t, filepath.Join(profilePath("Main"), pluginPath), filepath.Join(profilePath("Copy"), pluginPath)) {
+		t.Error("the plugin files were not linked")
+	}
+	configPath := filepath.Join("BepInEx", "config", "A.cfg")
+	if sameFile(t, filepath.Join(profilePath("Main"), configPath), filepath.Join(profilePath("Copy"), configPath)) {
+		t.Error("the config files were linked")
+	}
+	if exists(syncLinkPath("Copy")) {
+		t.Error("the sync link was cloned")
+	}
+}
+
+func sameFile(t *testing.T, pathA, pathB string) bool {
+	t.Helper()
+	infoA, err := os.Stat(pathA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoB, err := os.Stat(pathB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,196 @@
+package profile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+	"github.com/The-Lethal-Foundation/lethal-core/modconfig"
+)
+
+// ConfigSelection selects what CopyConfig copies: a whole file, one of its
+// sections, or a single entry. Leave Section empty to copy the file and Key
+// empty to copy the section.
+type ConfigSelection struct {
+	// File is the path relative to BepInEx/config, e.g. "MoreCompany.cfg".
+	File    string `json:"file"`
+	Section string `json:"section"`
+	Key     string `json:"key"`
+}
+
+// configDir returns the BepInEx config directory of the profile.
+func configDir(profileName string) string {
+	return filepath.Join(profilePath(profileName), "BepInEx", "config")
+}
+
+// listConfigFiles returns the .cfg files under dir relative to it.
+func listConfigFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".cfg") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+
+	return files, err
+}
+
+// isRelativeConfigPath reports whether file stays inside the config directory:
+// it must be relative and must not contain ".." once cleaned.
+func isRelativeConfigPath(file string) bool {
+	cleaned := filepath.Clean(filepath.FromSlash(file))
+	if cleaned == "." || filepath.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" || strings.HasPrefix(cleaned, string(filepath.Separator)) {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(cleaned), "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// readConfigFile parses a config file relative to dir. A missing file returns nil.
+func readConfigFile(dir, file string) (*modconfig.File, error) {
+	parsed, err := modconfig.ParseFile(filepath.Join(dir, filepath.FromSlash(file)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	return parsed, nil
+}
+
+// DiffConfigs compares every BepInEx/config .cfg entry of two profiles.
+// Entries only in toProfile are reported as added, entries only in fromProfile as removed.
+func DiffConfigs(fromProfile, toProfile string) ([]modconfig.Change, error) {
+	for _, name := range []string{fromProfile, toProfile} {
+		if err := requireExistingProfile(name); err != nil {
+			return nil, err
+		}
+	}
+	return diffConfigDirs(configDir(fromProfile), configDir(toProfile))
+}
+
+// diffConfigDirs compares every .cfg entry of two config directories.
+func diffConfigDirs(fromDir, toDir string) ([]modconfig.Change, error) {
+	fromFiles, err := listConfigFiles(fromDir)
+	if err != nil {
+		return nil, err
+	}
+	toFiles, err := listConfigFiles(toDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]bool{}
+	for _, file := range append(fromFiles, toFiles...) {
+		files[file] = true
+	}
+	var sortedFiles []string
+	for file := range files {
+		sortedFiles = append(sortedFiles, file)
+	}
+	sort.Strings(sortedFiles)
+
+	var changes []modconfig.Change
+	for _, file := range sortedFiles {
+		from, err := readConfigFile(fromDir, file)
+		if err != nil {
+			return nil, err
+		}
+		to, err := readConfigFile(toDir, file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, change := range modconfig.Diff(from, to) {
+			change.File = file
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// CopyConfig copies a config file, section or entry from one profile to another.
+// Sections and entries are merged into the destination file, which keeps its other settings.
+func CopyConfig(fromProfile, toProfile string, selection ConfigSelection) error {
+	for _, name := range []string{fromProfile, toProfile} {
+		if err := requireExistingProfile(name); err != nil {
+			return err
+		}
+	}
+	if selection.File == "" {
+		return fmt.Errorf("no config file selected")
+	}
+	if !isRelativeConfigPath(selection.File) {
+		return fmt.Errorf("invalid config file path %q: must be relative to BepInEx/config", selection.File)
+	}
+
+	srcPath := filepath.Join(configDir(fromProfile), filepath.FromSlash(selection.File))
+	dstPath := filepath.Join(configDir(toProfile), filepath.FromSlash(selection.File))
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+
+	if selection.Section == "" {
+		contents, err := os.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+		return fileutil.WriteFile(dstPath, contents, 0644)
+	}
+
+	src, err := readConfigFile(configDir(fromProfile), selection.File)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return fmt.Errorf("config file %s does not exist in profile %s", selection.File, fromProfile)
+	}
+
+	dst, err := readConfigFile(configDir(toProfile), selection.File)
+	if err != nil {
+		return err
+	}
+	if dst == nil {
+		dst = modconfig.New()
+	}
+
+	section := src.Section(selection.Section)
+	if section == nil {
+		return fmt.Errorf("section [%s] does not exist in %s", selection.Section, selection.File)
+	}
+
+	copied := 0
+	dst.AddSection(section.Name)
+	for _, entry := range section.Entries {
+		if selection.Key == "" || entry.Key == selection.Key {
+			dst.AddEntry(entry)
+			copied++
+		}
+	}
+	if copied == 0 {
+		return fmt.Errorf("entry [%s] %s does not exist in %s", selection.Section, selection.Key, selection.File)
+	}
+
+	return dst.Save(dstPath)
+}
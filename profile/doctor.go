@@ -0,0 +1,318 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+)
+
+type FindingKind string
+
+const (
+	MissingBepInExCore FindingKind = "missing-bepinex-core"
+	OutdatedBepInEx    FindingKind = "outdated-bepinex"
+	MissingPluginsDir  FindingKind = "missing-plugins-dir"
+	MissingManifest    FindingKind = "missing-manifest"
+	ManifestMismatch   FindingKind = "manifest-mismatch"
+	UnmetDependency    FindingKind = "unmet-dependency"
+	DuplicatePackage   FindingKind = "duplicate-package"
+	NestedPlugins      FindingKind = "nested-plugins"
+	StaleTempFile      FindingKind = "stale-temp-file"
+	PackageConflict    FindingKind = "package-conflict"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem Diagnose found in a profile.
+type Finding struct {
+	Kind     FindingKind `json:"kind"`
+	Severity Severity    `json:"severity"`
+	// Path is the affected file or directory, relative to the profile directory.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// Fixable is set when Repair can fix the finding automatically.
+	Fixable bool `json:"fixable"`
+	// Target is extra information Repair needs, e.g. the directory name to rename to
+	// or the dependency to install.
+	Target string `json:"target,omitempty"`
+}
+
+// staleTempAge is how old a leftover temporary file has to be before it is reported.
+const staleTempAge = time.Hour
+
+// Diagnose checks the profile for problems users typically cause by editing its folders by hand.
+func Diagnose(profileName string) ([]Finding, error) {
+	if err := requireProfile(profileName); err != nil {
+		return nil, err
+	}
+
+	path := profilePath(profileName)
+	pluginsDir := filepath.Join(path, "BepInEx", "plugins")
+	var findings []Finding
+
+	if _, err := os.Stat(filepath.Join(path, "BepInEx", "core", "BepInEx.Preloader.dll")); os.IsNotExist(err) {
+		findings = append(findings, Finding{
+			Kind: MissingBepInExCore, Severity: SeverityError, Path: "BepInEx/core", Fixable: true,
+			Message: "BepInEx core files are missing, no mods will load",
+		})
+	}
+
+	entries, err := os.ReadDir(pluginsDir)
+	if os.IsNotExist(err) {
+		findings = append(findings, Finding{
+			Kind: MissingPluginsDir, Severity: SeverityError, Path: "BepInEx/plugins", Fixable: true,
+			Message: "the plugins directory is missing",
+		})
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		relPath := "BepInEx/plugins/" + entry.Name()
+		modPath := filepath.Join(pluginsDir, entry.Name())
+
+		if _, err := os.Stat(filepath.Join(modPath, "manifest.json")); os.IsNotExist(err) {
+			findings = append(findings, Finding{
+				Kind: MissingManifest, Severity: SeverityWarning, Path: relPath,
+				Message: fmt.Sprintf("%s has no manifest.json and is not managed", entry.Name()),
+			})
+			continue
+		}
+
+		for _, nested := range []string{"plugins", filepath.Join("BepInEx", "plugins")} {
+			if info, err := os.Stat(filepath.Join(modPath, nested)); err == nil && info.IsDir() {
+				findings = append(findings, Finding{
+					Kind: NestedPlugins, Severity: SeverityWarning, Path: relPath + "/" + filepath.ToSlash(nested), Fixable: true,
+					Message: fmt.Sprintf("%s still has a nested plugins directory", entry.Name()),
+					Target:  entry.Name(),
+				})
+			}
+		}
+	}
+
+	mods, err := modmanager.ListMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, diagnoseMods(mods)...)
+
+	conflicts, err := modmanager.AnalyzeConflicts(profileName)
+	if err != nil {
+		return nil, err
+	}
+	for _, conflict := range conflicts {
+		findings = append(findings, Finding{
+			Kind: PackageConflict, Severity: SeverityWarning, Path: "BepInEx/plugins",
+			Message: conflict.String(),
+		})
+	}
+
+	metadata, err := GetMetadata(profileName)
+	if err != nil {
+		return nil, err
+	}
+	declared := modmanager.DeclaredBepInExPackVersion(mods)
+	if declared != "" && metadata.PinnedBepInExPackVersion == "" && metadata.BepInExPackVersion != "" &&
+		modmanager.CompareVersions(declared, metadata.BepInExPackVersion) > 0 {
+		findings = append(findings, Finding{
+			Kind: OutdatedBepInEx, Severity: SeverityWarning, Path: "BepInEx/core", Fixable: true,
+			Message: fmt.Sprintf("mods need BepInExPack %s, but %s is installed", declared, metadata.BepInExPackVersion),
+			Target:  declared,
+		})
+	}
+
+	staleFindings, err := findStaleTempFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, staleFindings...)
+
+	return findings, nil
+}
+
+// diagnoseMods checks the installed mods against their manifests and each other.
+func diagnoseMods(mods []modmanager.ModDetails) []Finding {
+	var findings []Finding
+
+	installed := map[string][]modmanager.ModDetails{}
+	for _, mod := range mods {
+		parts := strings.Split(mod.ModDirName, "-")
+		if len(parts) != 3 {
+			continue
+		}
+		id := parts[0] + "-" + parts[1]
+		installed[id] = append(installed[id], mod)
+
+		if parts[1] != mod.Manifest.Name || parts[2] != mod.Manifest.Version {
+			// The manifest comes from the mod, only rename to a plain directory name.
+			target := fmt.Sprintf("%s-%s-%s", parts[0], mod.Manifest.Name, mod.Manifest.Version)
+			findings = append(findings, Finding{
+				Kind: ManifestMismatch, Severity: SeverityWarning, Path: "BepInEx/plugins/" + mod.ModDirName, Fixable: isSingleDirName(target),
+				Message: fmt.Sprintf("%s contains %s %s according to its manifest", mod.ModDirName, mod.Manifest.Name, mod.Manifest.Version),
+				Target:  target,
+			})
+		}
+	}
+
+	for id, versions := range installed {
+		if len(versions) < 2 {
+			continue
+		}
+		newest := versions[0]
+		for _, mod := range versions[1:] {
+			if modmanager.CompareVersions(mod.Manifest.Version, newest.Manifest.Version) > 0 {
+				newest = mod
+			}
+		}
+		for _, mod := range versions {
+			if mod.ModDirName == newest.ModDirName {
+				continue
+			}
+			findings = append(findings, Finding{
+				Kind: DuplicatePackage, Severity: SeverityError, Path: "BepInEx/plugins/" + mod.ModDirName, Fixable: true,
+				Message: fmt.Sprintf("%s is installed more than once, %s is newer", id, newest.ModDirName),
+			})
+		}
+	}
+
+	for _, mod := range mods {
+		for _, dep := range mod.Manifest.Dependencies {
+			parts := strings.Split(dep, "-")
+			if len(parts) != 3 || parts[0] == "BepInEx" {
+				continue
+			}
+			if _, ok := installed[parts[0]+"-"+parts[1]]; !ok {
+				findings = append(findings, Finding{
+					Kind: UnmetDependency, Severity: SeverityError, Path: "BepInEx/plugins/" + mod.ModDirName, Fixable: isSingleDirName(dep),
+					Message: fmt.Sprintf("%s depends on %s, which is not installed", mod.ModDirName, dep),
+					Target:  dep,
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// findStaleTempFiles looks for leftovers of interrupted writes in the profile.
+func findStaleTempFiles(path string) ([]Finding, error) {
+	var findings []Finding
+	cutoff := time.Now().Add(-staleTempAge)
+
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(info.Name(), ".tmp") || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, Finding{
+			Kind: StaleTempFile, Severity: SeverityWarning, Path: filepath.ToSlash(relPath), Fixable: true,
+			Message: "leftover temporary file",
+		})
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return findings, nil
+}
+
+// findingKey identifies a finding for matching it against a fresh diagnosis.
+type findingKey struct {
+	kind   FindingKind
+	path   string
+	target string
+}
+
+// Repair fixes the fixable findings and returns the ones it fixed.
+// Findings are applied in the order given; Diagnose can be run again afterwards
+// to see what is left. The profile is diagnosed again first and only findings that
+// are still found are repaired, so paths and targets never come from the caller.
+func Repair(profileName string, findings []Finding) ([]Finding, error) {
+	if err := requireProfile(profileName); err != nil {
+		return nil, err
+	}
+	if err := requireNotRunning(profileName); err != nil {
+		return nil, err
+	}
+
+	fresh, err := Diagnose(profileName)
+	if err != nil {
+		return nil, err
+	}
+	current := map[findingKey]bool{}
+	for _, finding := range fresh {
+		if finding.Fixable {
+			current[findingKey{finding.Kind, finding.Path, finding.Target}] = true
+		}
+	}
+
+	path := profilePath(profileName)
+	var repaired []Finding
+	for _, finding := range findings {
+		if !current[findingKey{finding.Kind, finding.Path, finding.Target}] {
+			continue
+		}
+
+		var err error
+		switch finding.Kind {
+		case MissingBepInExCore:
+			err = installProfileBepInEx(profileName, "")
+		case OutdatedBepInEx:
+			err = installProfileBepInEx(profileName, finding.Target)
+		case MissingPluginsDir:
+			err = os.MkdirAll(filepath.Join(path, "BepInEx", "plugins"), 0755)
+		case ManifestMismatch:
+			target := filepath.Join(path, "BepInEx", "plugins", finding.Target)
+			if _, statErr := os.Stat(target); statErr == nil {
+				err = fmt.Errorf("%s already exists", finding.Target)
+			} else {
+				err = os.Rename(filepath.Join(path, filepath.FromSlash(finding.Path)), target)
+			}
+		case UnmetDependency:
+			parts := strings.Split(finding.Target, "-")
+			if len(parts) != 3 {
+				err = fmt.Errorf("invalid dependency %s", finding.Target)
+				break
+			}
+			err = modmanager.InstallModVersion(profileName, parts[0], parts[1], parts[2], true)
+		case DuplicatePackage:
+			err = os.RemoveAll(filepath.Join(path, filepath.FromSlash(finding.Path)))
+		case NestedPlugins:
+			err = modmanager.MovePlugins(filepath.Join(path, "BepInEx", "plugins", finding.Target))
+		case StaleTempFile:
+			err = os.RemoveAll(filepath.Join(path, filepath.FromSlash(finding.Path)))
+		default:
+			continue
+		}
+		if err != nil {
+			return repaired, fmt.Errorf("error repairing %s (%s): %w", finding.Kind, finding.Path, err)
+		}
+
+		repaired = append(repaired, finding)
+	}
+
+	return repaired, nil
+}
@@ -0,0 +1,233 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/external"
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+)
+
+// ImportStatus is what ImportProfiles did with a profile of another mod manager.
+type ImportStatus string
+
+const (
+	ImportStatusImported ImportStatus = "imported"
+	// ImportStatusLinked means the profile was imported before and is still linked
+	// to the external profile, it is kept up to date with ApplySync.
+	ImportStatusLinked ImportStatus = "linked"
+	ImportStatusFailed ImportStatus = "failed"
+)
+
+// ImportResult is the outcome of importing one profile of another mod manager.
+type ImportResult struct {
+	Source      external.Profile `json:"source"`
+	ProfileName string           `json:"profile_name"`
+	Status      ImportStatus     `json:"status"`
+	ModCount    int              `json:"mod_count"`
+	Err         error            `json:"-"`
+}
+
+// importSkippedFiles are files of the other managers that are not copied into the profile.
+var importSkippedFiles = map[string]bool{
+	external.ModsFileName: true,
+	MetadataFileName:      true,
+}
+
+// managerSources maps the external manager names to the profile source recorded in the metadata.
+var managerSources = map[string]Source{
+	"r2modman":     SourceR2modman,
+	"thunderstore": SourceThunderstore,
+	"gale":         SourceGale,
+}
+
+// ImportedProfileName returns the name an imported profile gets: the manager name
+// followed by the profile name, like r2modman-Default, made a valid profile name
+// with SanitizeName.
+func ImportedProfileName(source external.Profile) string {
+	return SanitizeName(source.Manager + "-" + source.Name)
+}
+
+// ImportProfiles imports the profiles of every manager enabled in the config's import
+// sources. Managers that aren't installed are skipped. Profiles that are still linked
+// to a profile imported before are reported as ImportStatusLinked, so running it again
+// doesn't duplicate profiles.
+func ImportProfiles() ([]ImportResult, error) {
+	var results []ImportResult
+	var errs []error
+
+	linked, err := linkedProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range config.Active().ImportSources {
+		manager, ok := external.FindManager(name)
+		if !ok {
+			log.Printf("Skipping unknown import source %s\n", name)
+			continue
+		}
+
+		sources, err := external.ListProfiles(manager)
+		if errors.Is(err, external.ErrManagerNotFound) {
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("error listing %s profiles: %w", manager.DisplayName, err))
+			continue
+		}
+
+		for _, source := range sources {
+			result := ImportResult{Source: source, ProfileName: ImportedProfileName(source), Status: ImportStatusImported}
+			if profileName, ok := linked[filepath.Clean(source.Path)]; ok {
+				result.ProfileName = profileName
+				result.Status = ImportStatusLinked
+				mods, err := external.ReadMods(source.Path)
+				result.ModCount, result.Err = len(mods), err
+			} else {
+				result.ModCount, result.Err = ImportProfile(source, result.ProfileName)
+			}
+			if result.Err != nil {
+				result.Status = ImportStatusFailed
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// linkedProfiles maps the paths of the linked external profiles to the profiles
+// linked to them.
+func linkedProfiles() (map[string]string, error) {
+	profiles, err := ListProfiles()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	linked := map[string]string{}
+	for _, profileName := range profiles {
+		link, err := GetSyncLink(profileName)
+		if err != nil {
+			// Not linked, or a profile with a name from before names were validated.
+			continue
+		}
+		linked[filepath.Clean(link.Source.Path)] = profileName
+	}
+	return linked, nil
+}
+
+// ImportProfile creates the profile profileName from a profile of another mod manager.
+// Plugin directories are renamed to Author-Name-Version and disabled mods stay disabled.
+// The new profile is linked to the source profile for syncing, see ApplySync.
+// It returns the number of mods the source profile has.
+func ImportProfile(source external.Profile, profileName string) (count int, err error) {
+	if err := requireNewProfile(profileName, ""); err != nil {
+		return 0, err
+	}
+
+	mods, err := external.ReadMods(source.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	dstPath := profilePath(profileName)
+	defer func() {
+		// Don't leave a half imported profile behind.
+		if err != nil {
+			os.RemoveAll(dstPath)
+		}
+	}()
+
+	if err := copyExternalProfile(source.Path, dstPath, mods); err != nil {
+		return 0, fmt.Errorf("error importing profile %s: %w", source.Name, err)
+	}
+	if err := os.MkdirAll(filepath.Join(dstPath, "BepInEx", "plugins"), 0755); err != nil {
+		return 0, err
+	}
+
+	metadata := &Metadata{
+		DisplayName:  source.Name,
+		CreatedAt:    time.Now(),
+		Source:       managerSources[source.Manager],
+		SourceDetail: source.Name,
+	}
+	for _, mod := range mods {
+		if mod.Author == modmanager.BepInExPackAuthor && mod.Name == modmanager.BepInExPackName {
+			metadata.BepInExPackVersion = mod.Version
+			continue
+		}
+
+		modDirName := externalModDirName(mod)
+		if _, err := os.Stat(filepath.Join(dstPath, "BepInEx", "plugins", modDirName)); err != nil || mod.Enabled {
+			continue
+		}
+		if err := modmanager.DisableMod(modDirName, profileName); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := SetMetadata(profileName, metadata); err != nil {
+		return 0, err
+	}
+
+	// Link the profile to its source, so later changes on either side can be synced.
+	if err := LinkProfile(profileName, source); err != nil {
+		return 0, err
+	}
+	return len(mods), nil
+}
+
+// copyExternalProfile copies the files of an external profile, renaming the plugin
+// directories of the mods from Author-Name to Author-Name-Version.
+func copyExternalProfile(srcPath, dstPath string, mods []external.Mod) error {
+	modDirNames := map[string]string{}
+	for _, mod := range mods {
+		modDirNames[mod.FullName()] = externalModDirName(mod)
+	}
+
+	return filepath.WalkDir(srcPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		slashPath := filepath.ToSlash(relPath)
+
+		if pluginPath, ok := strings.CutPrefix(slashPath, "BepInEx/plugins/"); ok {
+			dirName, rest, _ := strings.Cut(pluginPath, "/")
+			if modDirName, ok := modDirNames[dirName]; ok {
+				slashPath = "BepInEx/plugins/" + modDirName
+				if rest != "" {
+					slashPath += "/" + rest
+				}
+			}
+		}
+		target := filepath.Join(dstPath, filepath.FromSlash(slashPath))
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if importSkippedFiles[slashPath] || isSkippedCloneFile(slashPath) {
+			return nil
+		}
+		return fileutil.CopyFile(path, target)
+	})
+}
+
+// externalModDirName returns the plugin directory of the mod in a lethal-core profile.
+func externalModDirName(mod external.Mod) string {
+	return fmt.Sprintf("%s-%s-%s", mod.Author, mod.Name, mod.Version)
+}
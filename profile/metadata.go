@@ -0,0 +1,215 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+	"github.com/The-Lethal-Foundation/lethal-core/utils"
+)
+
+const MetadataFileName = "profile.json"
+
+type Source string
+
+const (
+	SourceUnknown      Source = "unknown"
+	SourceFresh        Source = "fresh"
+	SourceCloned       Source = "cloned"
+	SourceR2modman     Source = "r2modman"
+	SourceThunderstore Source = "thunderstore"
+	SourceGale         Source = "gale"
+	SourceImportCode   Source = "import-code"
+	SourceModpack      Source = "modpack"
+)
+
+// Metadata is stored with every profile in its profile.json.
+type Metadata struct {
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+	// Icon is a path relative to the profile directory, or a URL.
+	Icon           string    `json:"icon"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastLaunchedAt time.Time `json:"last_launched_at"`
+	Source         Source    `json:"source"`
+	// SourceDetail says where the profile came from, e.g. the profile it was cloned
+	// from, the r2modman profile name or the modpack package.
+	SourceDetail string `json:"source_detail"`
+	// BepInExPackVersion is the BepInExPack version installed in the profile.
+	BepInExPackVersion string `json:"bepinexpack_version"`
+	// PinnedBepInExPackVersion is a BepInExPack version the profile stays on instead of
+	// the version its mods declare.
+	PinnedBepInExPackVersion string   `json:"pinned_bepinexpack_version"`
+	Tags                     []string `json:"tags"`
+}
+
+// ProfileInfo is a profile together with its metadata, mod count and size on disk.
+type ProfileInfo struct {
+	Name     string   `json:"name"`
+	Metadata Metadata `json:"metadata"`
+	ModCount int      `json:"mod_count"`
+	// DiskSize is the size of the profile's files in bytes. Files hard-linked from the
+	// shared store or another profile are counted in full.
+	DiskSize int64 `json:"disk_size"`
+}
+
+var recordLaunchesOnce sync.Once
+
+// RecordLaunches makes launches through utils record the launch time in the profile
+// metadata. Call it once at startup, calling it again has no effect.
+func RecordLaunches() {
+	recordLaunchesOnce.Do(func() {
+		utils.OnGameLaunched(recordLaunch)
+	})
+}
+
+// recordLaunch sets the last launch time of the profile to now.
+func recordLaunch(profileName string) {
+	if err := UpdateMetadata(profileName, func(metadata *Metadata) error {
+		metadata.LastLaunchedAt = time.Now()
+		return nil
+	}); err != nil {
+		log.Printf("Failed to record launch time of profile %s: %v\n", profileName, err)
+	}
+}
+
+// GetMetadata reads the metadata of the profile. Profiles created before metadata
+// existed get defaults based on their directory.
+func GetMetadata(profileName string) (*Metadata, error) {
+	file, err := os.ReadFile(filepath.Join(profilePath(profileName), MetadataFileName))
+	if os.IsNotExist(err) {
+		info, err := os.Stat(profilePath(profileName))
+		if err != nil {
+			return nil, err
+		}
+		return &Metadata{
+			DisplayName: profileName,
+			CreatedAt:   info.ModTime(),
+			Source:      SourceUnknown,
+		}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stored struct {
+		Metadata
+		// LegacyPinnedBepInExVersion is the pin of older versions, see migratePinnedBepInEx.
+		LegacyPinnedBepInExVersion string `json:"pinned_bepinex_version"`
+	}
+	if err := json.Unmarshal(file, &stored); err != nil {
+		return nil, fmt.Errorf("error unmarshaling profile metadata: %w", err)
+	}
+
+	metadata := stored.Metadata
+	migratePinnedBepInEx(profileName, &metadata, stored.LegacyPinnedBepInExVersion)
+	return &metadata, nil
+}
+
+// migratePinnedBepInEx moves the pin older versions stored in pinned_bepinex_version.
+// It was first a BepInEx GitHub release (v5.4.23.2, four parts), then a BepInExPack
+// version (5.4.2100, three parts). Only BepInExPack versions can still be installed,
+// release pins are dropped. The migrated metadata is written on the next save.
+func migratePinnedBepInEx(profileName string, metadata *Metadata, legacy string) {
+	if legacy == "" || metadata.PinnedBepInExPackVersion != "" {
+		return
+	}
+	if strings.HasPrefix(legacy, "v") || strings.Count(legacy, ".") != 2 {
+		log.Printf("Dropping the BepInEx release pin %s of profile %s, profiles are pinned to BepInExPack versions now\n", legacy, profileName)
+		return
+	}
+	metadata.PinnedBepInExPackVersion = legacy
+}
+
+// SetMetadata saves the metadata of the profile.
+func SetMetadata(profileName string, metadata *Metadata) error {
+	if _, err := os.Stat(profilePath(profileName)); err != nil {
+		return err
+	}
+
+	metadataFile, err := json.MarshalIndent(metadata, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteFile(filepath.Join(profilePath(profileName), MetadataFileName), metadataFile, 0644)
+}
+
+// UpdateMetadata reads the metadata of the profile, applies update and saves it.
+// It holds the metadata lock, so updates from other processes are not lost.
+func UpdateMetadata(profileName string, update func(*Metadata) error) error {
+	if err := requireProfile(profileName); err != nil {
+		return err
+	}
+
+	lock, err := fileutil.LockFile(filepath.Join(profilePath(profileName), MetadataFileName))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	metadata, err := GetMetadata(profileName)
+	if err != nil {
+		return err
+	}
+	if err := update(metadata); err != nil {
+		return err
+	}
+	return SetMetadata(profileName, metadata)
+}
+
+// ListProfilesDetailed returns every profile with its metadata, mod count and size on disk.
+func ListProfilesDetailed() ([]ProfileInfo, error) {
+	names, err := ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []ProfileInfo
+	for _, name := range names {
+		metadata, err := GetMetadata(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading metadata of %s: %w", name, err)
+		}
+
+		mods, err := modmanager.ListMods(name)
+		if err != nil {
+			return nil, fmt.Errorf("error listing mods of %s: %w", name, err)
+		}
+
+		size, err := dirSize(profilePath(name))
+		if err != nil {
+			return nil, fmt.Errorf("error computing size of %s: %w", name, err)
+		}
+
+		profiles = append(profiles, ProfileInfo{
+			Name:     name,
+			Metadata: *metadata,
+			ModCount: len(mods),
+			DiskSize: size,
+		})
+	}
+
+	return profiles, nil
+}
+
+// dirSize sums the sizes of all files under path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,175 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/The-Lethal-Foundation/lethal-core/utils"
+)
+
+const maxProfileNameLength = 64
+
+var (
+	ErrProfileExists   = errors.New("profile already exists")
+	ErrProfileNotFound = errors.New("profile does not exist")
+	ErrProfileRunning  = errors.New("profile is used by a running game instance")
+)
+
+// InvalidNameError is returned for profile names that are not safe to use as a directory name.
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid profile name %q: %s", e.Name, e.Reason)
+}
+
+// windowsReservedNames can't be used as file names on Windows, with or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// ValidateName checks that the profile name is a single, portable directory name,
+// so it can't escape the profiles directory.
+func ValidateName(name string) error {
+	invalid := func(reason string) error {
+		return &InvalidNameError{Name: name, Reason: reason}
+	}
+
+	switch {
+	case strings.TrimSpace(name) == "":
+		return invalid("name is empty")
+	case len(name) > maxProfileNameLength:
+		return invalid(fmt.Sprintf("name is longer than %d characters", maxProfileNameLength))
+	case name == "." || name == "..":
+		return invalid("name is a relative path")
+	case strings.TrimSpace(name) != name:
+		return invalid("name starts or ends with whitespace")
+	case strings.HasSuffix(name, "."):
+		return invalid("name ends with a dot")
+	}
+
+	for _, r := range name {
+		if strings.ContainsRune(`<>:"/\|?*`, r) {
+			return invalid(fmt.Sprintf("name contains the reserved character %q", r))
+		}
+		if unicode.IsControl(r) {
+			return invalid("name contains a control character")
+		}
+	}
+
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(base)] {
+		return invalid("name is reserved by Windows")
+	}
+
+	return nil
+}
+
+// SanitizeName turns name into a name ValidateName accepts: reserved and control
+// characters become underscores, leading and trailing whitespace and trailing dots
+// are removed, the name is shortened to the maximum length and names reserved by
+// Windows get an underscore appended. An empty result becomes "Profile".
+func SanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	trim := func(name string) string {
+		for {
+			trimmed := strings.TrimRight(strings.TrimSpace(name), ".")
+			if trimmed == name {
+				return name
+			}
+			name = trimmed
+		}
+	}
+	name = trim(name)
+	for len(name) > maxProfileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = trim(name[:len(name)-size])
+	}
+	if name == "" {
+		return "Profile"
+	}
+
+	if base, ext, _ := strings.Cut(name, "."); windowsReservedNames[strings.ToUpper(base)] {
+		name = base + "_"
+		if ext != "" {
+			name += "." + ext
+		}
+		// The appended underscore may push the name over the limit again.
+		for len(name) > maxProfileNameLength {
+			_, size := utf8.DecodeLastRuneInString(name)
+			name = trim(name[:len(name)-size])
+		}
+	}
+	return name
+}
+
+// requireProfile validates the name and checks that the profile exists.
+func requireProfile(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	return requireExistingProfile(name)
+}
+
+// requireExistingProfile checks that the profile exists. It only rejects names that
+// aren't a single directory name, so profiles created before names were validated
+// can still be deleted or renamed to a valid name.
+func requireExistingProfile(name string) error {
+	if !isSingleDirName(name) {
+		return &InvalidNameError{Name: name, Reason: "name is not a single directory name"}
+	}
+	if _, err := os.Stat(profilePath(name)); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// isSingleDirName reports whether name is one directory name, which can't point
+// outside of the directory it is joined to.
+func isSingleDirName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name
+}
+
+// requireNewProfile validates the name and checks that no profile uses it yet.
+// existing may be the profile being renamed, which allows changing only the case of its name.
+func requireNewProfile(name, existing string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if strings.EqualFold(name, existing) {
+		return nil
+	}
+	if _, err := os.Stat(profilePath(name)); err == nil {
+		return fmt.Errorf("%w: %s", ErrProfileExists, name)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// requireNotRunning refuses to touch a profile while a game instance uses it.
+// Games started outside of this process are only detected on a best-effort basis,
+// see utils.IsProfileRunning.
+func requireNotRunning(name string) error {
+	if utils.IsProfileRunning(name) {
+		return fmt.Errorf("%w: %s", ErrProfileRunning, name)
+	}
+	return nil
+}
@@ -1,54 +1,143 @@
 package profile
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/The-Lethal-Foundation/lethal-core/config"
 	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
 	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
 )
 
-const ProfilesDirName = "Profiles"
+const ProfilesDirName = filesystem.ProfilesDirName
+
+// profilesDir returns the directory all profiles are in.
+func profilesDir() string {
+	return filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", ProfilesDirName)
+}
+
+// profilePath returns the directory of the profile.
+func profilePath(profileName string) string {
+	return filesystem.ProfilePath(profileName)
+}
 
 func CreateProfile(profileName string) error {
-	profilePath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", ProfilesDirName, profileName)
-	if err := os.Mkdir(profilePath, 0755); err != nil {
+	if err := requireNewProfile(profileName, ""); err != nil {
 		return err
 	}
 
-	// Unpack the BepInEx zip file into the profile directory.
-	// Assuming you have a function in modmanager to handle this.
-	err := modmanager.UnpackBepInEx(profilePath)
-	if err != nil {
+	path := profilePath(profileName)
+	if err := os.Mkdir(path, 0755); err != nil {
 		return err
 	}
 
 	// Create a "plugins" dir in BepInEx
-	pluginsPath := filepath.Join(profilePath, "BepInEx", "plugins")
-	if err := os.Mkdir(pluginsPath, 0755); err != nil {
+	pluginsPath := filepath.Join(path, "BepInEx", "plugins")
+	if err := os.MkdirAll(pluginsPath, 0755); err != nil {
 		return err
 	}
 
+	err := SetMetadata(profileName, &Metadata{
+		DisplayName: profileName,
+		CreatedAt:   time.Now(),
+		Source:      SourceFresh,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Install BepInEx from the Thunderstore BepInExPack, or from the cached
+	// GitHub release when Thunderstore can't be reached.
+	if err := installProfileBepInEx(profileName, ""); err != nil {
+		log.Printf("Failed to install BepInExPack into profile %s, using the cached BepInEx release: %v\n", profileName, err)
+		return modmanager.UnpackBepInEx(path)
+	}
+
 	return nil
 }
 
 // DeleteProfile deletes an existing profile.
 func DeleteProfile(profileName string) error {
-	profilePath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", ProfilesDirName, profileName)
-	return os.RemoveAll(profilePath)
+	if err := requireExistingProfile(profileName); err != nil {
+		return err
+	}
+	if err := requireNotRunning(profileName); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(profilePath(profileName))
 }
 
-// RenameProfile renames an existing profile.
+// RenameProfile renames an existing profile. The last used profile in the config
+// and the profile's display name follow the rename. If they can't be updated,
+// the profile is renamed back.
 func RenameProfile(oldName, newName string) error {
-	oldPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", ProfilesDirName, oldName)
-	newPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", ProfilesDirName, newName)
-	return os.Rename(oldPath, newPath)
+	if err := requireExistingProfile(oldName); err != nil {
+		return err
+	}
+	if err := requireNewProfile(newName, oldName); err != nil {
+		return err
+	}
+	if err := requireNotRunning(oldName); err != nil {
+		return err
+	}
+
+	oldPath := profilePath(oldName)
+	newPath := profilePath(newName)
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+
+	if err := renameReferences(oldName, newName); err != nil {
+		if rollbackErr := os.Rename(newPath, oldPath); rollbackErr != nil {
+			return fmt.Errorf("error updating profile references: %w (rolling back failed: %v)", err, rollbackErr)
+		}
+		return fmt.Errorf("error updating profile references: %w", err)
+	}
+
+	return nil
+}
+
+// renameReferences points the config and the profile metadata at the new profile name.
+// The metadata is restored if the config can't be saved.
+func renameReferences(oldName, newName string) error {
+	store, err := config.NewStore(filepath.Join(filesystem.GetDefaultPath(), config.ConfigFileName))
+	if err != nil {
+		return err
+	}
+
+	metadata, err := GetMetadata(newName)
+	if err != nil {
+		return err
+	}
+	previousMetadata := *metadata
+	if metadata.DisplayName == oldName || metadata.DisplayName == "" {
+		metadata.DisplayName = newName
+	}
+	if err := SetMetadata(newName, metadata); err != nil {
+		return err
+	}
+
+	err = store.Update(func(currentConfig *config.Config) error {
+		if currentConfig.LastUsedProfile == oldName {
+			currentConfig.LastUsedProfile = newName
+		}
+		return nil
+	})
+	if err != nil {
+		SetMetadata(newName, &previousMetadata)
+		return err
+	}
+
+	return nil
 }
 
 // ListProfiles returns a list of all profiles.
 func ListProfiles() ([]string, error) {
-	profilesPath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", ProfilesDirName)
-	dirEntries, err := os.ReadDir(profilesPath)
+	dirEntries, err := os.ReadDir(profilesDir())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,402 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+	"github.com/The-Lethal-Foundation/lethal-core/modconfig"
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+)
+
+const SnapshotsDirName = ".snapshots"
+const snapshotFileName = "snapshot.json"
+
+// snapshotRestorePrefix starts the staging directories of restores in the snapshots directory.
+const snapshotRestorePrefix = ".restore-"
+
+// SnapshotMod is an installed mod recorded in a snapshot.
+type SnapshotMod struct {
+	Author     string `json:"author"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	ModDirName string `json:"mod_dir_name"`
+	Enabled    bool   `json:"enabled"`
+	// Stored is set for mods whose directory isn't named Author-Name-Version, so they
+	// can't be reinstalled from Thunderstore. Their files are kept in the snapshot.
+	Stored bool `json:"stored"`
+}
+
+// packageKey identifies the mod across versions: Author-Name, or the directory name of stored mods.
+func (m SnapshotMod) packageKey() string {
+	if m.Stored {
+		return m.ModDirName
+	}
+	return m.Author + "-" + m.Name
+}
+
+// Snapshot records the mods, their versions and enabled state, and the config files
+// of a profile at a point in time. Mod files are only stored for mods that can't be
+// reinstalled; restoring reinstalls the others.
+type Snapshot struct {
+	ID        string        `json:"id"`
+	Label     string        `json:"label"`
+	CreatedAt time.Time     `json:"created_at"`
+	Mods      []SnapshotMod `json:"mods"`
+}
+
+// ModChange is a mod whose version or enabled state differs from the snapshot.
+type ModChange struct {
+	Snapshot SnapshotMod `json:"snapshot"`
+	Current  SnapshotMod `json:"current"`
+}
+
+// SnapshotDiff is the difference between a snapshot and the current state of the profile.
+type SnapshotDiff struct {
+	// ModsAdded were installed after the snapshot was taken.
+	ModsAdded []SnapshotMod `json:"mods_added"`
+	// ModsRemoved were in the snapshot but are no longer installed.
+	ModsRemoved []SnapshotMod `json:"mods_removed"`
+	ModsChanged []ModChange   `json:"mods_changed"`
+	// Configs compares the snapshot configs (from) against the current ones (to).
+	Configs []modconfig.Change `json:"configs"`
+}
+
+func snapshotsPath(profileName string) string {
+	return filepath.Join(profilePath(profileName), SnapshotsDirName)
+}
+
+func snapshotPath(profileName, id string) string {
+	return filepath.Join(snapshotsPath(profileName), id)
+}
+
+// storedModPath returns where a snapshot keeps the files of a stored mod.
+func storedModPath(profileName, id, modDirName string) string {
+	return filepath.Join(snapshotPath(profileName, id), "plugins", modDirName)
+}
+
+func pluginsDir(profileName string) string {
+	return filepath.Join(profilePath(profileName), "BepInEx", "plugins")
+}
+
+// currentSnapshotMods lists the installed mods of the profile as snapshot mods.
+func currentSnapshotMods(profileName string) ([]SnapshotMod, error) {
+	mods, err := modmanager.ListMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshotMods []SnapshotMod
+	for _, mod := range mods {
+		parts := strings.Split(mod.ModDirName, "-")
+		if len(parts) != 3 {
+			snapshotMods = append(snapshotMods, SnapshotMod{ModDirName: mod.ModDirName, Enabled: mod.Enabled, Stored: true})
+			continue
+		}
+		snapshotMods = append(snapshotMods, SnapshotMod{
+			Author:     parts[0],
+			Name:       parts[1],
+			Version:    parts[2],
+			ModDirName: mod.ModDirName,
+			Enabled:    mod.Enabled,
+		})
+	}
+	return snapshotMods, nil
+}
+
+// CreateSnapshot records the current mods and config files of the profile.
+func CreateSnapshot(profileName, label string) (*Snapshot, error) {
+	if err := requireProfile(profileName); err != nil {
+		return nil, err
+	}
+
+	mods, err := currentSnapshotMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snapshot := &Snapshot{
+		ID:        now.UTC().Format("20060102-150405.000000"),
+		Label:     label,
+		CreatedAt: now,
+		Mods:      mods,
+	}
+
+	path := snapshotPath(profileName, snapshot.ID)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := copyDir(configDir(profileName), filepath.Join(path, "config")); err != nil {
+		os.RemoveAll(path)
+		return nil, fmt.Errorf("error copying configs: %w", err)
+	}
+	for _, mod := range mods {
+		if !mod.Stored {
+			continue
+		}
+		if err := copyDir(filepath.Join(pluginsDir(profileName), mod.ModDirName), storedModPath(profileName, snapshot.ID, mod.ModDirName)); err != nil {
+			os.RemoveAll(path)
+			return nil, fmt.Errorf("error copying %s: %w", mod.ModDirName, err)
+		}
+	}
+
+	snapshotFile, err := json.MarshalIndent(snapshot, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := fileutil.WriteFile(filepath.Join(path, snapshotFileName), snapshotFile, 0644); err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// GetSnapshot reads a snapshot of the profile.
+func GetSnapshot(profileName, id string) (*Snapshot, error) {
+	file, err := os.ReadFile(filepath.Join(snapshotPath(profileName, id), snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(file, &snapshot); err != nil {
+		return nil, fmt.Errorf("error unmarshaling snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// ListSnapshots returns the snapshots of the profile, oldest first.
+func ListSnapshots(profileName string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(snapshotsPath(profileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), snapshotRestorePrefix) {
+			continue
+		}
+		snapshot, err := GetSnapshot(profileName, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot %s: %w", entry.Name(), err)
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// DeleteSnapshot deletes a snapshot of the profile.
+func DeleteSnapshot(profileName, id string) error {
+	if _, err := GetSnapshot(profileName, id); err != nil {
+		return err
+	}
+	return os.RemoveAll(snapshotPath(profileName, id))
+}
+
+// DiffSnapshot compares a snapshot against the current state of the profile.
+func DiffSnapshot(profileName, id string) (*SnapshotDiff, error) {
+	snapshot, err := GetSnapshot(profileName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := currentSnapshotMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &SnapshotDiff{}
+	snapshotMods := snapshotModsByPackage(snapshot.Mods)
+	currentMods := snapshotModsByPackage(current)
+
+	for _, mod := range snapshot.Mods {
+		currentMod, ok := currentMods[mod.packageKey()]
+		if !ok {
+			diff.ModsRemoved = append(diff.ModsRemoved, mod)
+		} else if currentMod.Version != mod.Version || currentMod.Enabled != mod.Enabled {
+			diff.ModsChanged = append(diff.ModsChanged, ModChange{Snapshot: mod, Current: currentMod})
+		}
+	}
+	for _, mod := range current {
+		if _, ok := snapshotMods[mod.packageKey()]; !ok {
+			diff.ModsAdded = append(diff.ModsAdded, mod)
+		}
+	}
+
+	diff.Configs, err = diffConfigDirs(filepath.Join(snapshotPath(profileName, id), "config"), configDir(profileName))
+	if err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// RestoreSnapshot brings the profile back to the snapshot: mods installed since are
+// removed, the recorded versions are reinstalled, the enabled state is reapplied and
+// the config files are replaced with the recorded ones.
+//
+// Missing mods and the configs are prepared in a staging directory first, so a failed
+// download leaves the profile untouched. The profile is then only changed by renames,
+// which are undone if one of them fails.
+func RestoreSnapshot(profileName, id string) error {
+	if err := requireNotRunning(profileName); err != nil {
+		return err
+	}
+
+	snapshot, err := GetSnapshot(profileName, id)
+	if err != nil {
+		return err
+	}
+
+	current, err := currentSnapshotMods(profileName)
+	if err != nil {
+		return err
+	}
+	installed := map[string]bool{}
+	for _, mod := range current {
+		installed[mod.ModDirName] = true
+	}
+
+	stagingPath := filepath.Join(snapshotsPath(profileName), snapshotRestorePrefix+id)
+	if err := os.RemoveAll(stagingPath); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingPath)
+
+	// Stage the mods that aren't installed and the recorded configs.
+	var staged []string
+	for _, mod := range snapshot.Mods {
+		if installed[mod.ModDirName] {
+			continue
+		}
+
+		modPath := filepath.Join(stagingPath, "plugins", mod.ModDirName)
+		if mod.Stored {
+			err = copyDir(storedModPath(profileName, id, mod.ModDirName), modPath)
+		} else {
+			err = modmanager.ExtractModVersion(mod.Author, mod.Name, mod.Version, modPath)
+		}
+		if err != nil {
+			return fmt.Errorf("error reinstalling %s: %w", mod.ModDirName, err)
+		}
+		staged = append(staged, mod.ModDirName)
+	}
+	if err := copyDir(filepath.Join(snapshotPath(profileName, id), "config"), filepath.Join(stagingPath, "config")); err != nil {
+		return fmt.Errorf("error copying configs: %w", err)
+	}
+
+	// Swap the staged files in, moving what they replace into the staging directory.
+	wanted := map[string]bool{}
+	for _, mod := range snapshot.Mods {
+		wanted[mod.ModDirName] = true
+	}
+	var moves []restoreMove
+	for _, mod := range current {
+		if !wanted[mod.ModDirName] {
+			moves = append(moves, restoreMove{filepath.Join(pluginsDir(profileName), mod.ModDirName), filepath.Join(stagingPath, "removed", mod.ModDirName)})
+		}
+	}
+	moves = append(moves, restoreMove{configDir(profileName), filepath.Join(stagingPath, "removed", "config")})
+	for _, modDirName := range staged {
+		moves = append(moves, restoreMove{filepath.Join(stagingPath, "plugins", modDirName), filepath.Join(pluginsDir(profileName), modDirName)})
+	}
+	moves = append(moves, restoreMove{filepath.Join(stagingPath, "config"), configDir(profileName)})
+
+	if err := applyRestoreMoves(moves); err != nil {
+		return fmt.Errorf("error restoring snapshot: %w", err)
+	}
+
+	// Reapply the recorded enabled state.
+	for _, mod := range snapshot.Mods {
+		if mod.Enabled {
+			err = modmanager.EnableMod(mod.ModDirName, profileName)
+		} else {
+			err = modmanager.DisableMod(mod.ModDirName, profileName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreMove is a rename done while swapping a restore in.
+type restoreMove struct {
+	from, to string
+}
+
+// applyRestoreMoves renames every from to its to, skipping sources that don't exist.
+// If a rename fails, the renames done so far are undone.
+func applyRestoreMoves(moves []restoreMove) error {
+	var done []restoreMove
+	for _, move := range moves {
+		if _, err := os.Stat(move.from); os.IsNotExist(err) {
+			continue
+		}
+
+		err := os.MkdirAll(filepath.Dir(move.to), 0755)
+		if err == nil {
+			err = os.Rename(move.from, move.to)
+		}
+		if err != nil {
+			for i := len(done) - 1; i >= 0; i-- {
+				os.Rename(done[i].to, done[i].from)
+			}
+			return err
+		}
+		done = append(done, move)
+	}
+	return nil
+}
+
+func snapshotModsByPackage(mods []SnapshotMod) map[string]SnapshotMod {
+	byPackage := map[string]SnapshotMod{}
+	for _, mod := range mods {
+		byPackage[mod.packageKey()] = mod
+	}
+	return byPackage
+}
+
+// copyDir copies every file under src to dst. A missing src creates an empty dst.
+func copyDir(src, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == src {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return fileutil.CopyFile(path, target)
+	})
+}
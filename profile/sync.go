@@ -0,0 +1,727 @@
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/The-Lethal-Foundation/lethal-core/external"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+	"github.com/The-Lethal-Foundation/lethal-core/modconfig"
+	"github.com/The-Lethal-Foundation/lethal-core/modmanager"
+)
+
+// SyncFileName links a profile to the external profile it is synced with.
+const SyncFileName = "sync.json"
+
+var (
+	ErrNotLinked    = errors.New("profile is not linked to an external profile")
+	ErrSyncConflict = errors.New("profile and external profile have conflicting changes")
+)
+
+// SyncLink is the external profile a profile is synced with, and the state both had
+// after the last sync. Comparing each side against that state tells which side
+// changed something since.
+type SyncLink struct {
+	Source     external.Profile `json:"source"`
+	LastSynced time.Time        `json:"last_synced"`
+	// Mods are the mods both profiles had, without the BepInExPack.
+	Mods []external.Mod `json:"mods"`
+	// Configs are the SHA-256 hashes of the BepInEx/config files both profiles had.
+	Configs map[string]string `json:"configs"`
+}
+
+// SyncSide says which profile changed something since the last sync.
+type SyncSide string
+
+const (
+	SyncSideLocal    SyncSide = "local"
+	SyncSideExternal SyncSide = "external"
+	// SyncSideBoth is a conflict: both profiles changed it, differently.
+	SyncSideBoth SyncSide = "both"
+)
+
+// SyncDirection is how ApplySync applies the differences.
+type SyncDirection string
+
+const (
+	// SyncPull makes the profile match the external profile.
+	SyncPull SyncDirection = "pull"
+	// SyncPush makes the external profile match the profile.
+	SyncPush SyncDirection = "push"
+	// SyncMerge applies the changes of each side to the other. It fails with
+	// ErrSyncConflict when both sides changed the same mod or config file.
+	SyncMerge SyncDirection = "merge"
+)
+
+// SyncModChange is a mod that differs between the profile and the external profile.
+// A nil mod is not installed on that side.
+type SyncModChange struct {
+	Package   string        `json:"package"`
+	Base      *external.Mod `json:"base"`
+	Local     *external.Mod `json:"local"`
+	External  *external.Mod `json:"external"`
+	ChangedOn SyncSide      `json:"changed_on"`
+}
+
+// SyncConfigChange is a config file that differs between the profile and the external profile.
+type SyncConfigChange struct {
+	// File is the path relative to BepInEx/config.
+	File      string   `json:"file"`
+	ChangedOn SyncSide `json:"changed_on"`
+	// Changes compare the entries of the local file (from) against the external one (to).
+	Changes []modconfig.Change `json:"changes"`
+}
+
+// SyncDiff is everything that differs between a profile and its external profile.
+type SyncDiff struct {
+	Source  external.Profile   `json:"source"`
+	Mods    []SyncModChange    `json:"mods"`
+	Configs []SyncConfigChange `json:"configs"`
+}
+
+// Conflicts returns how many mods and config files both sides changed.
+func (d *SyncDiff) Conflicts() int {
+	var conflicts int
+	for _, mod := range d.Mods {
+		if mod.ChangedOn == SyncSideBoth {
+			conflicts++
+		}
+	}
+	for _, config := range d.Configs {
+		if config.ChangedOn == SyncSideBoth {
+			conflicts++
+		}
+	}
+	return conflicts
+}
+
+// syncState is the mods and config file hashes of one side.
+type syncState struct {
+	mods    map[string]external.Mod
+	configs map[string]string
+}
+
+func syncLinkPath(profileName string) string {
+	return filepath.Join(profilePath(profileName), SyncFileName)
+}
+
+// GetSyncLink returns the sync link of the profile, or ErrNotLinked.
+func GetSyncLink(profileName string) (*SyncLink, error) {
+	if err := requireProfile(profileName); err != nil {
+		return nil, err
+	}
+
+	file, err := os.ReadFile(syncLinkPath(profileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotLinked, profileName)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var link SyncLink
+	if err := json.Unmarshal(file, &link); err != nil {
+		return nil, fmt.Errorf("error unmarshaling sync link: %w", err)
+	}
+	return &link, nil
+}
+
+// LinkProfile links the profile to an external profile for syncing. The current state
+// of the profile becomes the last synced state, so everything that differs in the
+// external profile shows up as an external change.
+func LinkProfile(profileName string, source external.Profile) error {
+	if err := requireProfile(profileName); err != nil {
+		return err
+	}
+	if _, err := os.Stat(source.Path); err != nil {
+		return err
+	}
+
+	local, err := localSyncState(profileName)
+	if err != nil {
+		return err
+	}
+	return saveSyncLink(profileName, source, local)
+}
+
+// UnlinkProfile removes the sync link of the profile.
+func UnlinkProfile(profileName string) error {
+	if err := requireProfile(profileName); err != nil {
+		return err
+	}
+	if err := os.Remove(syncLinkPath(profileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DiffSync compares the profile with its linked external profile.
+func DiffSync(profileName string) (*SyncDiff, error) {
+	link, err := GetSyncLink(profileName)
+	if err != nil {
+		return nil, err
+	}
+	return diffSync(profileName, link)
+}
+
+func diffSync(profileName string, link *SyncLink) (*SyncDiff, error) {
+	local, err := localSyncState(profileName)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := externalSyncState(link.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	base := map[string]external.Mod{}
+	for _, mod := range link.Mods {
+		base[mod.FullName()] = mod
+	}
+
+	diff := &SyncDiff{Source: link.Source}
+	for _, pkg := range sortedKeys(local.mods, remote.mods) {
+		localMod, remoteMod, baseMod := modAt(local.mods, pkg), modAt(remote.mods, pkg), modAt(base, pkg)
+		if sameMod(localMod, remoteMod) {
+			continue
+		}
+		diff.Mods = append(diff.Mods, SyncModChange{
+			Package:   pkg,
+			Base:      baseMod,
+			Local:     localMod,
+			External:  remoteMod,
+			ChangedOn: changedOn(sameMod(localMod, baseMod), sameMod(remoteMod, baseMod)),
+		})
+	}
+
+	localDir, remoteDir := configDir(profileName), externalConfigDir(link.Source.Path)
+	for _, file := range sortedKeys(local.configs, remote.configs) {
+		localHash, remoteHash, baseHash := local.configs[file], remote.configs[file], link.Configs[file]
+		if localHash == remoteHash {
+			continue
+		}
+
+		from, err := readConfigFile(localDir, file)
+		if err != nil {
+			return nil, err
+		}
+		to, err := readConfigFile(remoteDir, file)
+		if err != nil {
+			return nil, err
+		}
+		changes := modconfig.Diff(from, to)
+		for i := range changes {
+			changes[i].File = file
+		}
+
+		diff.Configs = append(diff.Configs, SyncConfigChange{
+			File:      file,
+			ChangedOn: changedOn(localHash == baseHash, remoteHash == baseHash),
+			Changes:   changes,
+		})
+	}
+
+	return diff, nil
+}
+
+// ApplySync syncs the profile with its linked external profile in the given direction
+// and records the synced state. Nothing is changed when a merge has conflicts. Everything
+// it changes on either side is backed up first and restored when the sync fails partway.
+func ApplySync(profileName string, direction SyncDirection) (diff *SyncDiff, err error) {
+	if err := requireNotRunning(profileName); err != nil {
+		return nil, err
+	}
+
+	link, err := GetSyncLink(profileName)
+	if err != nil {
+		return nil, err
+	}
+	diff, err = diffSync(profileName, link)
+	if err != nil {
+		return nil, err
+	}
+
+	switch direction {
+	case SyncPull, SyncPush:
+	case SyncMerge:
+		if conflicts := diff.Conflicts(); conflicts > 0 {
+			return diff, fmt.Errorf("%w: %d conflicts, pull or push to resolve them", ErrSyncConflict, conflicts)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sync direction %q", direction)
+	}
+
+	// pull reports whether the external side wins for a change.
+	pull := func(changedOn SyncSide) bool {
+		return direction == SyncPull || (direction == SyncMerge && changedOn == SyncSideExternal)
+	}
+
+	localMods, err := currentSnapshotMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+	localDirs := map[string]string{}
+	for _, mod := range localMods {
+		if !mod.Stored {
+			localDirs[mod.packageKey()] = mod.ModDirName
+		}
+	}
+
+	backup, err := newSyncBackup()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err == nil {
+			backup.remove()
+			return
+		}
+		if rollbackErr := backup.restore(); rollbackErr != nil {
+			err = fmt.Errorf("%w (rolling back failed: %v, the changed files are backed up in %s)", err, rollbackErr, backup.dir)
+			return
+		}
+		backup.remove()
+	}()
+
+	if err := backup.save(syncLinkPath(profileName)); err != nil {
+		return nil, err
+	}
+	for _, change := range diff.Mods {
+		if !isSingleDirName(change.Package) {
+			return nil, fmt.Errorf("error syncing %s: invalid package name", change.Package)
+		}
+
+		localDirName := localDirs[change.Package]
+		if pull(change.ChangedOn) {
+			err = backup.save(localModPaths(profileName, change.Package, localDirName, change.External)...)
+			if err == nil {
+				err = pullMod(profileName, link.Source, change.Package, localDirName, change.External)
+			}
+		} else {
+			err = backup.save(externalModPaths(link.Source.Path, change.Package)...)
+			if err == nil {
+				err = pushMod(profileName, link.Source, localDirName, change.Package, change.Local)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error syncing %s: %w", change.Package, err)
+		}
+	}
+
+	localDir, remoteDir := configDir(profileName), externalConfigDir(link.Source.Path)
+	for _, change := range diff.Configs {
+		fromDir, toDir := localDir, remoteDir
+		if pull(change.ChangedOn) {
+			fromDir, toDir = remoteDir, localDir
+		}
+		err = backup.save(filepath.Join(toDir, filepath.FromSlash(change.File)))
+		if err == nil {
+			err = syncConfigFile(fromDir, toDir, change.File)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error syncing %s: %w", change.File, err)
+		}
+	}
+
+	if len(diff.Mods) > 0 {
+		if err := backup.save(filepath.Join(link.Source.Path, external.ModsFileName)); err != nil {
+			return nil, err
+		}
+		if err := writeExternalMods(profileName, link.Source.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	local, err := localSyncState(profileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveSyncLink(profileName, link.Source, local); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// syncedPackageDirs are the BepInEx directories besides plugins that packages have
+// an Author-Name directory in. Profiles keep them the same way as external profiles.
+var syncedPackageDirs = []string{"patchers", "core"}
+
+// localModPaths returns the local directories pulling the mod can change.
+func localModPaths(profileName, pkg, localDirName string, mod *external.Mod) []string {
+	pluginsDir := filepath.Join(profilePath(profileName), "BepInEx", "plugins")
+	var paths []string
+	if localDirName != "" {
+		paths = append(paths, filepath.Join(pluginsDir, localDirName))
+	}
+	if mod != nil {
+		paths = append(paths, filepath.Join(pluginsDir, externalModDirName(*mod)))
+	}
+	for _, dir := range syncedPackageDirs {
+		paths = append(paths, filepath.Join(profilePath(profileName), "BepInEx", dir, pkg))
+	}
+	return paths
+}
+
+// externalModPaths returns the external directories pushing the mod can change.
+func externalModPaths(externalPath, pkg string) []string {
+	var paths []string
+	for _, dir := range append([]string{"plugins"}, syncedPackageDirs...) {
+		paths = append(paths, filepath.Join(externalPath, "BepInEx", dir, pkg))
+	}
+	return paths
+}
+
+// pullMod makes the local mod match the external mod, which is nil when it was removed.
+// The files are copied from the external profile, or installed when it has no plugins
+// directory for the mod.
+func pullMod(profileName string, source external.Profile, pkg, localDirName string, mod *external.Mod) error {
+	if localDirName != "" {
+		if err := modmanager.DeleteMod(profileName, localDirName); err != nil {
+			return err
+		}
+	}
+	for _, dir := range syncedPackageDirs {
+		if err := os.RemoveAll(filepath.Join(profilePath(profileName), "BepInEx", dir, pkg)); err != nil {
+			return err
+		}
+	}
+	if mod == nil {
+		return nil
+	}
+
+	modDirName := externalModDirName(*mod)
+	srcPath := filepath.Join(source.Path, "BepInEx", "plugins", pkg)
+	if _, err := os.Stat(srcPath); err != nil {
+		if err := modmanager.InstallModVersion(profileName, mod.Author, mod.Name, mod.Version, false); err != nil {
+			return err
+		}
+		return setModEnabled(profileName, modDirName, mod.Enabled)
+	}
+
+	if err := copyDir(srcPath, filepath.Join(profilePath(profileName), "BepInEx", "plugins", modDirName)); err != nil {
+		return err
+	}
+	for _, dir := range syncedPackageDirs {
+		srcPath := filepath.Join(source.Path, "BepInEx", dir, pkg)
+		if _, err := os.Stat(srcPath); err != nil {
+			continue
+		}
+		dstPath := filepath.Join(profilePath(profileName), "BepInEx", dir, pkg)
+		if err := copyDir(srcPath, dstPath); err != nil {
+			return err
+		}
+		if err := modmanager.SetModDirEnabled(dstPath, mod.Enabled); err != nil {
+			return err
+		}
+	}
+	return setModEnabled(profileName, modDirName, mod.Enabled)
+}
+
+// setModEnabled enables or disables the plugins directory of a local mod.
+func setModEnabled(profileName, modDirName string, enabled bool) error {
+	if enabled {
+		return modmanager.EnableMod(modDirName, profileName)
+	}
+	return modmanager.DisableMod(modDirName, profileName)
+}
+
+// pushMod makes the external mod match the local mod, which is nil when it was removed.
+func pushMod(profileName string, source external.Profile, localDirName, pkg string, mod *external.Mod) error {
+	for _, dstPath := range externalModPaths(source.Path, pkg) {
+		if err := os.RemoveAll(dstPath); err != nil {
+			return err
+		}
+	}
+	if mod == nil {
+		return nil
+	}
+
+	if err := copyDir(filepath.Join(profilePath(profileName), "BepInEx", "plugins", localDirName), filepath.Join(source.Path, "BepInEx", "plugins", pkg)); err != nil {
+		return err
+	}
+	for _, dir := range syncedPackageDirs {
+		srcPath := filepath.Join(profilePath(profileName), "BepInEx", dir, pkg)
+		if _, err := os.Stat(srcPath); err != nil {
+			continue
+		}
+		if err := copyDir(srcPath, filepath.Join(source.Path, "BepInEx", dir, pkg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncConfigFile copies a config file from one config dir to another, or removes it
+// from the other dir when it doesn't exist in the first.
+func syncConfigFile(fromDir, toDir, file string) error {
+	from := filepath.Join(fromDir, filepath.FromSlash(file))
+	to := filepath.Join(toDir, filepath.FromSlash(file))
+
+	data, err := os.ReadFile(from)
+	if os.IsNotExist(err) {
+		if err := os.Remove(to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(to, data, 0644)
+}
+
+// syncBackupPrefix starts the directories ApplySync backs up changed files in, in the cache.
+const syncBackupPrefix = "sync-backup-"
+
+// syncBackup keeps copies of the files and directories a sync changes, so they can
+// be restored when it fails partway.
+type syncBackup struct {
+	dir     string
+	entries []syncBackupEntry
+	saved   map[string]bool
+}
+
+type syncBackupEntry struct {
+	path string
+	// copy is where the original is kept, empty if path didn't exist.
+	copy  string
+	isDir bool
+}
+
+func newSyncBackup() (*syncBackup, error) {
+	cacheDir := filepath.Join(filesystem.GetDefaultPath(), filesystem.DefaultCacheDir)
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(cacheDir, syncBackupPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &syncBackup{dir: dir, saved: map[string]bool{}}, nil
+}
+
+// save copies the paths into the backup before they are changed. Paths that were
+// saved before are skipped, they already hold the original.
+func (b *syncBackup) save(paths ...string) error {
+	for _, path := range paths {
+		if b.saved[path] {
+			continue
+		}
+
+		entry := syncBackupEntry{path: path}
+		info, err := os.Stat(path)
+		if err == nil {
+			entry.copy = filepath.Join(b.dir, strconv.Itoa(len(b.entries)))
+			entry.isDir = info.IsDir()
+			if entry.isDir {
+				err = copyDir(path, entry.copy)
+			} else {
+				err = fileutil.CopyFile(path, entry.copy)
+			}
+			if err != nil {
+				return fmt.Errorf("error backing up %s: %w", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		b.saved[path] = true
+		b.entries = append(b.entries, entry)
+	}
+	return nil
+}
+
+// restore puts back the originals of all saved paths.
+func (b *syncBackup) restore() error {
+	var errs []error
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		entry := b.entries[i]
+		if err := os.RemoveAll(entry.path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var err error
+		switch {
+		case entry.copy == "":
+		case entry.isDir:
+			err = copyDir(entry.copy, entry.path)
+		default:
+			err = os.MkdirAll(filepath.Dir(entry.path), 0755)
+			if err == nil {
+				err = fileutil.CopyFile(entry.copy, entry.path)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *syncBackup) remove() {
+	os.RemoveAll(b.dir)
+}
+
+// writeExternalMods writes the mods of the profile into the external mods.yml,
+// keeping the BepInExPack entry of the external profile.
+func writeExternalMods(profileName, externalPath string) error {
+	externalMods, err := external.ReadMods(externalPath)
+	if err != nil {
+		return err
+	}
+	local, err := localSyncState(profileName)
+	if err != nil {
+		return err
+	}
+
+	var mods []external.Mod
+	for _, mod := range externalMods {
+		if isBepInExPack(mod) {
+			mods = append(mods, mod)
+		}
+	}
+	for _, pkg := range sortedKeys(local.mods) {
+		mods = append(mods, local.mods[pkg])
+	}
+
+	return external.WriteMods(externalPath, mods)
+}
+
+// saveSyncLink records state as the state both profiles had after syncing.
+func saveSyncLink(profileName string, source external.Profile, state *syncState) error {
+	link := SyncLink{
+		Source:     source,
+		LastSynced: time.Now(),
+		Configs:    state.configs,
+	}
+	for _, pkg := range sortedKeys(state.mods) {
+		link.Mods = append(link.Mods, state.mods[pkg])
+	}
+
+	data, err := json.MarshalIndent(link, "", "    ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(syncLinkPath(profileName), data, 0644)
+}
+
+// localSyncState reads the mods and config hashes of the profile.
+func localSyncState(profileName string) (*syncState, error) {
+	mods, err := currentSnapshotMods(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &syncState{mods: map[string]external.Mod{}}
+	for _, mod := range mods {
+		// Mods that aren't Thunderstore packages can't be listed in the external profile.
+		if mod.Stored {
+			continue
+		}
+		state.mods[mod.packageKey()] = external.Mod{Author: mod.Author, Name: mod.Name, Version: mod.Version, Enabled: mod.Enabled}
+	}
+
+	state.configs, err = hashConfigFiles(configDir(profileName))
+	return state, err
+}
+
+// externalSyncState reads the mods and config hashes of an external profile.
+func externalSyncState(externalPath string) (*syncState, error) {
+	mods, err := external.ReadMods(externalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &syncState{mods: map[string]external.Mod{}}
+	for _, mod := range mods {
+		if !isBepInExPack(mod) {
+			state.mods[mod.FullName()] = mod
+		}
+	}
+
+	state.configs, err = hashConfigFiles(externalConfigDir(externalPath))
+	return state, err
+}
+
+func externalConfigDir(externalPath string) string {
+	return filepath.Join(externalPath, "BepInEx", "config")
+}
+
+// hashConfigFiles returns the SHA-256 of every .cfg file under dir.
+func hashConfigFiles(dir string) (map[string]string, error) {
+	files, err := listConfigFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := map[string]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		hashes[file] = hex.EncodeToString(sum[:])
+	}
+	return hashes, nil
+}
+
+// isBepInExPack reports whether the mod is the BepInExPack, which every manager
+// installs on its own and is not synced.
+func isBepInExPack(mod external.Mod) bool {
+	return mod.Author == modmanager.BepInExPackAuthor && mod.Name == modmanager.BepInExPackName
+}
+
+// changedOn returns which side changed, given whether each side still matches the last sync.
+func changedOn(localUnchanged, externalUnchanged bool) SyncSide {
+	switch {
+	case localUnchanged:
+		return SyncSideExternal
+	case externalUnchanged:
+		return SyncSideLocal
+	default:
+		return SyncSideBoth
+	}
+}
+
+func modAt(mods map[string]external.Mod, pkg string) *external.Mod {
+	if mod, ok := mods[pkg]; ok {
+		return &mod
+	}
+	return nil
+}
+
+func sameMod(a, b *external.Mod) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sortedKeys returns the keys of all maps, sorted.
+func sortedKeys[V any](maps ...map[string]V) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
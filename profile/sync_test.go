@@ -0,0 +1,197 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/The-Lethal-Foundation/lethal-core/external"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// setupSync creates the profile Main and an external profile with the same mods,
+// links them and returns the external profile.
+func setupSync(t *testing.T, mods ...external.Mod) external.Profile {
+	t.Helper()
+	basePath := t.TempDir()
+	getDefaultPath := filesystem.GetDefaultPath
+	filesystem.GetDefaultPath = func() string { return basePath }
+	t.Cleanup(func() { filesystem.GetDefaultPath = getDefaultPath })
+
+	source := external.Profile{Manager: "r2modman", Name: "Main", Path: filepath.Join(t.TempDir(), "Main")}
+	mustMkdir(t, filepath.Join(profilePath("Main"), "BepInEx", "plugins"))
+	mustMkdir(t, filepath.Join(source.Path, "BepInEx", "plugins"))
+	for _, mod := range mods {
+		writeLocalMod(t, mod)
+		writeExternalMod(t, source, mod)
+	}
+	writeExternalModsFile(t, source, mods...)
+
+	if err := LinkProfile("Main", source); err != nil {
+		t.Fatalf("LinkProfile() failed: %v", err)
+	}
+	return source
+}
+
+func mustMkdir(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustWriteFile(t *testing.T, path, content string) {
+	t.Helper()
+	mustMkdir(t, filepath.Dir(path))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeModFiles(t *testing.T, dir string, mod external.Mod) {
+	t.Helper()
+	mustWriteFile(t, filepath.Join(dir, "manifest.json"), `{"name": "`+mod.Name+`", "version_number": "`+mod.Version+`"}`)
+	mustWriteFile(t, filepath.Join(dir, mod.Name+".dll"), mod.Version)
+}
+
+func writeLocalMod(t *testing.T, mod external.Mod) {
+	writeModFiles(t, filepath.Join(profilePath("Main"), "BepInEx", "plugins", externalModDirName(mod)), mod)
+}
+
+func writeExternalMod(t *testing.T, source external.Profile, mod external.Mod) {
+	writeModFiles(t, filepath.Join(source.Path, "BepInEx", "plugins", mod.FullName()), mod)
+}
+
+func writeExternalModsFile(t *testing.T, source external.Profile, mods ...external.Mod) {
+	t.Helper()
+	if err := external.WriteMods(source.Path, mods); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestDiffSync(t *testing.T) {
+	a := external.Mod{Author: "x753", Name: "A", Version: "1.0.0", Enabled: true}
+	b := external.Mod{Author: "x753", Name: "B", Version: "1.0.0", Enabled: true}
+	c := external.Mod{Author: "x753", Name: "C", Version: "1.0.0", Enabled: true}
+	source := setupSync(t, a, b, c)
+
+	// A is updated locally, B externally, and C differently on both sides. D is new externally.
+	os.RemoveAll(filepath.Join(profilePath("Main"), "BepInEx", "plugins", externalModDirName(a)))
+	os.RemoveAll(filepath.Join(profilePath("Main"), "BepInEx", "plugins", externalModDirName(c)))
+	a2 := external.Mod{Author: "x753", Name: "A", Version: "1.1.0", Enabled: true}
+	c2 := external.Mod{Author: "x753", Name: "C", Version: "2.0.0", Enabled: true}
+	c3 := external.Mod{Author: "x753", Name: "C", Version: "3.0.0", Enabled: true}
+	writeLocalMod(t, a2)
+	writeLocalMod(t, c2)
+	b2 := external.Mod{Author: "x753", Name: "B", Version: "1.2.0", Enabled: true}
+	d := external.Mod{Author: "x753", Name: "D", Version: "1.0.0", Enabled: true}
+	writeExternalModsFile(t, source, a, b2, c3, d)
+	mustWriteFile(t, filepath.Join(configDir("Main"), "A.cfg"), "[General]\nEnabled = true\n")
+
+	diff, err := DiffSync("Main")
+	if err != nil {
+		t.Fatalf("DiffSync() failed: %v", err)
+	}
+
+	want := map[string]SyncSide{"x753-A": SyncSideLocal, "x753-B": SyncSideExternal, "x753-C": SyncSideBoth, "x753-D": SyncSideExternal}
+	if len(diff.Mods) != len(want) {
+		t.Fatalf("DiffSync() mods = %+v, want %d changes", diff.Mods, len(want))
+	}
+	for _, change := range diff.Mods {
+		if change.ChangedOn != want[change.Package] {
+			t.Errorf("%s changed on %s, want %s", change.Package, change.ChangedOn, want[change.Package])
+		}
+	}
+	if len(diff.Configs) != 1 || diff.Configs[0].File != "A.cfg" || diff.Configs[0].ChangedOn != SyncSideLocal {
+		t.Errorf("DiffSync() configs = %+v, want A.cfg changed locally", diff.Configs)
+	}
+	if diff.Conflicts() != 1 {
+		t.Errorf("Conflicts() = %d, want 1", diff.Conflicts())
+	}
+
+	if _, err := ApplySync("Main", SyncMerge); err == nil {
+		t.Error("ApplySync() merged conflicting changes")
+	}
+}
+
+func TestApplySyncMerge(t *testing.T) {
+	a := external.Mod{Author: "x753", Name: "A", Version: "1.0.0", Enabled: true}
+	source := setupSync(t, a)
+
+	// D is added externally together with its patchers, a config file locally.
+	d := external.Mod{Author: "x753", Name: "D", Version: "1.0.0", Enabled: true}
+	writeExternalMod(t, source, d)
+	mustWriteFile(t, filepath.Join(source.Path, "BepInEx", "patchers", d.FullName(), "DPatcher.dll"), "")
+	writeExternalModsFile(t, source, a, d)
+	mustWriteFile(t, filepath.Join(configDir("Main"), "A.cfg"), "[General]\nEnabled = true\n")
+
+	if _, err := ApplySync("Main", SyncMerge); err != nil {
+		t.Fatalf("ApplySync() failed: %v", err)
+	}
+
+	if !exists(filepath.Join(profilePath("Main"), "BepInEx", "plugins", externalModDirName(d), "D.dll")) {
+		t.Error("the external mod was not pulled")
+	}
+	if !exists(filepath.Join(profilePath("Main"), "BepInEx", "patchers", d.FullName(), "DPatcher.dll")) {
+		t.Error("the patchers of the external mod were not pulled")
+	}
+	if !exists(filepath.Join(externalConfigDir(source.Path), "A.cfg")) {
+		t.Error("the local config file was not pushed")
+	}
+
+	diff, err := DiffSync("Main")
+	if err != nil {
+		t.Fatalf("DiffSync() failed: %v", err)
+	}
+	if len(diff.Mods) != 0 || len(diff.Configs) != 0 {
+		t.Errorf("DiffSync() after syncing = %+v, want no differences", diff)
+	}
+}
+
+func TestApplySyncRollsBack(t *testing.T) {
+	a := external.Mod{Author: "x753", Name: "A", Version: "1.0.0", Enabled: true}
+	source := setupSync(t, a)
+	link, err := os.ReadFile(syncLinkPath("Main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A is updated externally and pulled, B is added locally and pushed. Writing the
+	// external mods.yml fails afterwards, because it can't hold B's version number.
+	a2 := external.Mod{Author: "x753", Name: "A", Version: "1.1.0", Enabled: true}
+	os.RemoveAll(filepath.Join(source.Path, "BepInEx", "plugins", a.FullName()))
+	writeExternalMod(t, source, a2)
+	writeExternalModsFile(t, source, a2)
+	modsFile, err := os.ReadFile(filepath.Join(source.Path, external.ModsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := external.Mod{Author: "x753", Name: "B", Version: "1.0", Enabled: true}
+	writeLocalMod(t, b)
+
+	if _, err := ApplySync("Main", SyncMerge); err == nil {
+		t.Fatal("ApplySync() succeeded, want writing mods.yml to fail")
+	}
+
+	pluginsDir := filepath.Join(profilePath("Main"), "BepInEx", "plugins")
+	if !exists(filepath.Join(pluginsDir, externalModDirName(a), "A.dll")) || exists(filepath.Join(pluginsDir, externalModDirName(a2))) {
+		t.Error("the pulled mod was not rolled back")
+	}
+	if exists(filepath.Join(source.Path, "BepInEx", "plugins", b.FullName())) {
+		t.Error("the pushed mod was not rolled back")
+	}
+	if after, _ := os.ReadFile(filepath.Join(source.Path, external.ModsFileName)); string(after) != string(modsFile) {
+		t.Error("the external mods.yml changed")
+	}
+	if after, _ := os.ReadFile(syncLinkPath("Main")); string(after) != string(link) {
+		t.Error("the sync link changed")
+	}
+	if backups, _ := filepath.Glob(filepath.Join(filesystem.GetDefaultPath(), filesystem.DefaultCacheDir, syncBackupPrefix+"*")); len(backups) != 0 {
+		t.Errorf("the backup was not removed: %v", backups)
+	}
+}
@@ -1,7 +1,20 @@
 package utils
 
+import "github.com/The-Lethal-Foundation/lethal-core/config"
+
 // map of the mod manager name to the path of the profiles directory
 var KnownModManagersList = map[string]string{
 	"thunderstore": "Thunderstore Mod Manager\\DataFolder\\LethalCompany\\profiles",
 	"r2modman":     "r2modmanPlus-local\\LethalCompany\\profiles",
 }
+
+// EnabledModManagers returns the known mod managers enabled as import sources in the config.
+func EnabledModManagers() map[string]string {
+	managers := map[string]string{}
+	for _, source := range config.Active().ImportSources {
+		if profilesPath, ok := KnownModManagersList[source]; ok {
+			managers[source] = profilesPath
+		}
+	}
+	return managers
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// GameInstance is one game started by LaunchGameInstances.
+type GameInstance struct {
+	*GameProcess
+
+	// LogFile is the Unity player log the instance writes to.
+	LogFile string
+}
+
+// GameInstanceGroup holds game instances that are monitored and shut down together.
+type GameInstanceGroup struct {
+	Instances []*GameInstance
+}
+
+// LaunchGameInstances starts one direct-exe game instance per entry in profiles,
+// for testing networking mods locally. A profile may be listed more than once.
+// Each instance writes its Unity log to its own file inside the profile directory.
+// If any instance fails to start, the ones already started are killed.
+func LaunchGameInstances(profiles []string) (*GameInstanceGroup, error) {
+	gameDir, err := FindGameInstallDir()
+	if err != nil {
+		return nil, err
+	}
+
+	group := &GameInstanceGroup{}
+	for i, profile := range profiles {
+		logFile := filepath.Join(filesystem.ProfilePath(profile), fmt.Sprintf("instance-%d.log", i+1))
+		if err := os.Remove(logFile); err != nil && !os.IsNotExist(err) {
+			group.KillAll()
+			return nil, err
+		}
+
+		process, err := launchDirect(gameDir, profile, nil, "-logFile", logFile)
+		if err != nil {
+			group.KillAll()
+			return nil, fmt.Errorf("error launching instance %d (%s): %w", i+1, profile, err)
+		}
+
+		group.Instances = append(group.Instances, &GameInstance{GameProcess: process, LogFile: logFile})
+	}
+
+	return group, nil
+}
+
+// Running returns the instances that have not exited yet.
+func (g *GameInstanceGroup) Running() []*GameInstance {
+	var running []*GameInstance
+	for _, instance := range g.Instances {
+		if !instance.Exited() {
+			running = append(running, instance)
+		}
+	}
+	return running
+}
+
+// Wait blocks until every instance has exited and returns their exit codes in launch order.
+func (g *GameInstanceGroup) Wait() ([]int, error) {
+	exitCodes := make([]int, len(g.Instances))
+
+	var errs []error
+	for i, instance := range g.Instances {
+		exitCode, err := instance.Wait()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("instance %d (%s): %w", i+1, instance.Profile, err))
+		}
+		exitCodes[i] = exitCode
+	}
+
+	return exitCodes, errors.Join(errs...)
+}
+
+// KillAll terminates every instance that is still running and waits for them to exit.
+func (g *GameInstanceGroup) KillAll() error {
+	var errs []error
+	var killed []*GameInstance
+	for i, instance := range g.Instances {
+		if err := instance.Kill(); err != nil {
+			errs = append(errs, fmt.Errorf("instance %d (%s): %w", i+1, instance.Profile, err))
+			continue
+		}
+		killed = append(killed, instance)
+	}
+
+	for _, instance := range killed {
+		<-instance.Done()
+	}
+
+	return errors.Join(errs...)
+}
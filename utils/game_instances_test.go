@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLaunchGameInstances(t *testing.T) {
+	gameDir := writeFakeGame(t, "exit 0")
+	t.Setenv("LETHAL_CORE_GAME_PATH", gameDir)
+	hostPath := setupProfile(t, "Host")
+	if err := os.MkdirAll(filepath.Join(filepath.Dir(hostPath), "Client"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := LaunchGameInstances([]string{"Host", "Client", "Client"})
+	if err != nil {
+		t.Fatalf("LaunchGameInstances() failed: %v", err)
+	}
+	exitCodes, err := group.Wait()
+	if err != nil || !reflect.DeepEqual(exitCodes, []int{0, 0, 0}) {
+		t.Fatalf("Wait() = %v, %v, want every instance to exit with 0", exitCodes, err)
+	}
+	if running := group.Running(); len(running) != 0 {
+		t.Errorf("Running() = %d instances after Wait()", len(running))
+	}
+
+	wantLogs := []string{
+		filepath.Join(hostPath, "instance-1.log"),
+		filepath.Join(filepath.Dir(hostPath), "Client", "instance-2.log"),
+		filepath.Join(filepath.Dir(hostPath), "Client", "instance-3.log"),
+	}
+	for i, instance := range group.Instances {
+		if instance.LogFile != wantLogs[i] {
+			t.Errorf("instance %d logs to %s, want %s", i+1, instance.LogFile, wantLogs[i])
+		}
+	}
+	args, err := os.ReadFile(filepath.Join(gameDir, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, logFile := range wantLogs {
+		if !strings.Contains(string(args), "-logFile\n"+logFile+"\n") {
+			t.Errorf("no instance was started with -logFile %s", logFile)
+		}
+	}
+}
+
+func TestLaunchGameInstancesKillsStartedOnFailure(t *testing.T) {
+	gameDir := writeFakeGame(t, "exec sleep 30")
+	t.Setenv("LETHAL_CORE_GAME_PATH", gameDir)
+	hostPath := setupProfile(t, "Host")
+
+	// The launch settings of the second profile can't be read.
+	brokenPath := filepath.Join(filepath.Dir(hostPath), "Broken")
+	if err := os.MkdirAll(brokenPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(brokenPath, LaunchSettingsFileName), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LaunchGameInstances([]string{"Host", "Broken"}); err == nil {
+		t.Fatal("LaunchGameInstances() succeeded with broken launch settings")
+	}
+	if IsProfileRunning("Host") {
+		t.Error("the started instance is still running")
+	}
+}
+
+func TestGameInstanceGroupKillAll(t *testing.T) {
+	gameDir := writeFakeGame(t, "exec sleep 30")
+	t.Setenv("LETHAL_CORE_GAME_PATH", gameDir)
+	setupProfile(t, "Host")
+
+	group, err := LaunchGameInstances([]string{"Host", "Host"})
+	if err != nil {
+		t.Fatalf("LaunchGameInstances() failed: %v", err)
+	}
+	if running := group.Running(); len(running) != 2 || !IsProfileRunning("Host") {
+		t.Fatalf("Running() = %d instances, want 2", len(running))
+	}
+
+	if err := group.KillAll(); err != nil {
+		t.Fatalf("KillAll() failed: %v", err)
+	}
+	if running := group.Running(); len(running) != 0 || IsProfileRunning("Host") {
+		t.Errorf("Running() = %d instances after KillAll()", len(running))
+	}
+	for i, instance := range group.Instances {
+		if instance.ExitCode() != -1 {
+			t.Errorf("instance %d exit code = %d, want -1 for a killed game", i+1, instance.ExitCode())
+		}
+	}
+}
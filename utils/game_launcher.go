@@ -2,37 +2,167 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"sync"
 
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/doorstop"
 	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
 )
 
 const GameId = "1966720"
 
-// LaunchGameProfile launches the game with the specified profile.
+// launchListeners are called with the profile name after the game was launched.
+var (
+	launchListenersMu sync.Mutex
+	launchListeners   []func(profile string)
+)
+
+// OnGameLaunched registers a function that is called after a profile was launched.
+func OnGameLaunched(listener func(profile string)) {
+	launchListenersMu.Lock()
+	defer launchListenersMu.Unlock()
+	launchListeners = append(launchListeners, listener)
+}
+
+func notifyGameLaunched(profile string) {
+	launchListenersMu.Lock()
+	listeners := append([]func(profile string){}, launchListeners...)
+	launchListenersMu.Unlock()
+
+	for _, listener := range listeners {
+		listener(profile)
+	}
+}
+
+// LaunchGameProfile launches the game with the specified profile, through Steam or
+// directly, depending on the launch mode in the config.
 func LaunchGameProfile(profile string) error {
-	// Assuming `util.GetProfilePath` resolves the correct profile path.
-	profilePath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", "Profiles", profile)
+	if config.Active().LaunchMode == config.LaunchModeDirect {
+		_, err := LaunchGameProfileDirect(profile, os.Stdout)
+		return err
+	}
 
-	steamPath := `C:\Program Files (x86)\Steam\steam.exe`
-	args := []string{
-		"-applaunch",
-		GameId,
-		"--doorstop-enable", "true",
-		"--doorstop-target", fmt.Sprintf("%s\\BepInEx\\core\\BepInEx.Preloader.dll", profilePath),
+	profilePath := filesystem.ProfilePath(profile)
+
+	gameArgs, _, err := prepareLaunch(profilePath, profile, config.LaunchModeSteam)
+	if err != nil {
+		return err
 	}
+	args := append([]string{"-applaunch", GameId}, gameArgs...)
 
 	// Run the command
-	cmd := exec.Command(steamPath, args...)
+	cmd := exec.Command(steamExecutable(), args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		return fmt.Errorf("failed to launch game: %w", err)
 	}
 
 	fmt.Println("Game launched successfully")
+	notifyGameLaunched(profile)
 	return nil
 }
+
+// LaunchGameProfileDirect starts the game executable from the discovered install
+// directory with the specified profile, bypassing Steam's -applaunch.
+// The game's output is written to output, which may be nil.
+func LaunchGameProfileDirect(profile string, output io.Writer) (*GameProcess, error) {
+	gameDir, err := FindGameInstallDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return launchDirect(gameDir, profile, output)
+}
+
+// launchDirect starts the game executable in gameDir with the specified profile.
+// Any extraArgs are passed to the game after the profile's own launch arguments.
+func launchDirect(gameDir, profile string, output io.Writer, extraArgs ...string) (*GameProcess, error) {
+	profilePath := filesystem.ProfilePath(profile)
+	gameArgs, settings, err := prepareLaunch(profilePath, profile, config.LaunchModeDirect)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(filepath.Join(gameDir, GameExecutableName), append(gameArgs, extraArgs...)...)
+	cmd.Dir = gameDir
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	// Lets the Steam API initialize without Steam restarting the game through -applaunch.
+	cmd.Env = append(os.Environ(), "SteamAppId="+GameId, "SteamGameId="+GameId)
+	cmd.Env = append(cmd.Env, settings.environmentList()...)
+
+	process, err := startGameProcess(profile, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to launch game: %w", err)
+	}
+
+	notifyGameLaunched(profile)
+	return process, nil
+}
+
+// prepareLaunch loads the profile's launch settings, checks them against the
+// launch mode, runs the pre-launch check and returns the arguments to pass to the game.
+func prepareLaunch(profilePath, profile, launchMode string) ([]string, *LaunchSettings, error) {
+	settings, err := GetLaunchSettings(profile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading launch settings: %w", err)
+	}
+
+	if err := settings.Validate(launchMode); err != nil {
+		return nil, nil, err
+	}
+
+	if err := runPreLaunchCommand(profilePath, settings); err != nil {
+		return nil, nil, err
+	}
+
+	args, err := profileDoorstopArgs(profilePath, settings.Vanilla)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append(args, settings.ExtraArgs...), settings, nil
+}
+
+// profileDoorstopArgs returns the Doorstop arguments that point the game at the profile's BepInEx,
+// based on the profile's doorstop_config.ini. Profiles without one use the BepInEx defaults.
+// When vanilla is set, Doorstop is disabled and no mods are loaded.
+func profileDoorstopArgs(profilePath string, vanilla bool) ([]string, error) {
+	doorstopConfig, err := doorstop.ReadConfig(profilePath)
+	if os.IsNotExist(err) {
+		doorstopConfig = doorstop.DefaultConfig()
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading doorstop config: %w", err)
+	}
+
+	args := []string{
+		"--doorstop-enable", strconv.FormatBool(doorstopConfig.Enabled && !vanilla),
+		"--doorstop-target", doorstop.ResolveTargetAssembly(profilePath, doorstopConfig),
+	}
+	if doorstopConfig.DllSearchPathOverride != "" {
+		args = append(args, "--mono-dll-search-path-override", doorstopConfig.DllSearchPathOverride)
+	}
+
+	return args, nil
+}
+
+// ValidateProfileDoorstop reports missing or mismatched Doorstop files of the profile.
+// The proxy dll in the game directory is checked too when the game can be found.
+func ValidateProfileDoorstop(profile string) ([]doorstop.Problem, error) {
+	profilePath := filesystem.ProfilePath(profile)
+
+	gameDir, err := FindGameInstallDir()
+	if err != nil {
+		gameDir = ""
+	}
+
+	return doorstop.Validate(profilePath, gameDir)
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// setupProfile points the default path at a temporary directory and creates the profile in it.
+func setupProfile(t *testing.T, profile string) string {
+	t.Helper()
+	basePath := t.TempDir()
+	getDefaultPath := filesystem.GetDefaultPath
+	filesystem.GetDefaultPath = func() string { return basePath }
+	t.Cleanup(func() { filesystem.GetDefaultPath = getDefaultPath })
+
+	profilePath := filepath.Join(basePath, "LethalCompany", "Profiles", profile)
+	if err := os.MkdirAll(profilePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return profilePath
+}
+
+func TestProfileDoorstopArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		ini     string
+		vanilla bool
+		want    []string
+	}{
+		{
+			name: "defaults without doorstop_config.ini",
+			want: []string{"--doorstop-enable", "true", "--doorstop-target", "BepInEx/core/BepInEx.Preloader.dll"},
+		},
+		{
+			name:    "vanilla",
+			vanilla: true,
+			want:    []string{"--doorstop-enable", "false", "--doorstop-target", "BepInEx/core/BepInEx.Preloader.dll"},
+		},
+		{
+			name: "doorstop 4 config",
+			ini:  "[General]\nenabled = false\ntarget_assembly = BepInEx\\core\\Custom.dll\n[UnityMono]\ndll_search_path_override = Unstripped\n",
+			want: []string{"--doorstop-enable", "false", "--doorstop-target", "BepInEx/core/Custom.dll", "--mono-dll-search-path-override", "Unstripped"},
+		},
+	}
+
+	for _, test := range tests {
+		profilePath := t.TempDir()
+		if test.ini != "" {
+			if err := os.WriteFile(filepath.Join(profilePath, "doorstop_config.ini"), []byte(test.ini), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		args, err := profileDoorstopArgs(profilePath, test.vanilla)
+		if err != nil {
+			t.Fatalf("%s: profileDoorstopArgs() failed: %v", test.name, err)
+		}
+		want := append([]string(nil), test.want...)
+		want[3] = filepath.Join(profilePath, filepath.FromSlash(want[3]))
+		if !reflect.DeepEqual(args, want) {
+			t.Errorf("%s: profileDoorstopArgs() = %q, want %q", test.name, args, want)
+		}
+	}
+}
+
+func TestPrepareLaunch(t *testing.T) {
+	profilePath := setupProfile(t, "Main")
+	settings := &LaunchSettings{ExtraArgs: []string{"-screen-fullscreen", "0"}}
+	if err := SetLaunchSettings("Main", settings); err != nil {
+		t.Fatalf("SetLaunchSettings() failed: %v", err)
+	}
+
+	args, _, err := prepareLaunch(profilePath, "Main", config.LaunchModeSteam)
+	if err != nil {
+		t.Fatalf("prepareLaunch() failed: %v", err)
+	}
+	if len(args) != 6 || args[0] != "--doorstop-enable" || !reflect.DeepEqual(args[4:], settings.ExtraArgs) {
+		t.Errorf("prepareLaunch() = %q, want the doorstop arguments followed by %q", args, settings.ExtraArgs)
+	}
+
+	settings.PreLaunchCommand = []string{filepath.Join(profilePath, "missing-check")}
+	if err := SetLaunchSettings("Main", settings); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := prepareLaunch(profilePath, "Main", config.LaunchModeSteam); err == nil || !strings.Contains(err.Error(), "pre-launch check failed") {
+		t.Errorf("prepareLaunch() error = %v, want the failed pre-launch check", err)
+	}
+}
+
+// writeFakeGame writes a game executable that records its arguments and
+// environment next to itself and then runs the shell command last, e.g. "exit 3".
+func writeFakeGame(t *testing.T, last string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake game executable is a shell script")
+	}
+
+	gameDir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"printf '%s\\n' \"$@\" >> \"$(dirname \"$0\")/args.txt\"\n" +
+		"echo \"$SteamAppId $LETHAL_TEST\" >> \"$(dirname \"$0\")/env.txt\"\n" +
+		last + "\n"
+	if err := os.WriteFile(filepath.Join(gameDir, GameExecutableName), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return gameDir
+}
+
+func TestLaunchDirect(t *testing.T) {
+	gameDir := writeFakeGame(t, "exit 3")
+	setupProfile(t, "Main")
+	t.Setenv("LETHAL_CORE_LAUNCH_MODE", config.LaunchModeDirect)
+	err := SetLaunchSettings("Main", &LaunchSettings{
+		ExtraArgs:   []string{"-screen-fullscreen", "0"},
+		Environment: map[string]string{"LETHAL_TEST": "yes"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	process, err := launchDirect(gameDir, "Main", nil, "-logFile", "out.log")
+	if err != nil {
+		t.Fatalf("launchDirect() failed: %v", err)
+	}
+	exitCode, err := process.Wait()
+	if err != nil || exitCode != 3 {
+		t.Fatalf("Wait() = %d, %v, want exit code 3", exitCode, err)
+	}
+	if !process.Exited() || process.ExitCode() != 3 {
+		t.Errorf("Exited() = %v, ExitCode() = %d after Wait()", process.Exited(), process.ExitCode())
+	}
+	if IsProfileRunning("Main") {
+		t.Error("IsProfileRunning() = true after the game exited")
+	}
+
+	args, err := os.ReadFile(filepath.Join(gameDir, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(args), "-screen-fullscreen\n0\n-logFile\nout.log\n") {
+		t.Errorf("game arguments:\n%s\nwant the extra arguments last", args)
+	}
+	env, err := os.ReadFile(filepath.Join(gameDir, "env.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(env) != GameId+" yes\n" {
+		t.Errorf("game environment = %q, want the Steam app id and the profile environment", env)
+	}
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+)
+
+// GameProcess is a handle to a game instance started directly from its executable.
+type GameProcess struct {
+	Profile string
+
+	cmd      *exec.Cmd
+	done     chan struct{}
+	exitCode int
+	err      error
+}
+
+var (
+	runningGamesMu sync.Mutex
+	runningGames   = map[*GameProcess]struct{}{}
+)
+
+// startGameProcess starts the command and tracks it until it exits.
+func startGameProcess(profile string, cmd *exec.Cmd) (*GameProcess, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	process := &GameProcess{
+		Profile:  profile,
+		cmd:      cmd,
+		done:     make(chan struct{}),
+		exitCode: -1,
+	}
+
+	runningGamesMu.Lock()
+	runningGames[process] = struct{}{}
+	runningGamesMu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+
+		var exitErr *exec.ExitError
+		if err == nil || errors.As(err, &exitErr) {
+			process.exitCode = cmd.ProcessState.ExitCode()
+		} else {
+			process.err = err
+		}
+
+		runningGamesMu.Lock()
+		delete(runningGames, process)
+		runningGamesMu.Unlock()
+
+		close(process.done)
+	}()
+
+	return process, nil
+}
+
+// PID returns the operating system process id of the game.
+func (p *GameProcess) PID() int {
+	return p.cmd.Process.Pid
+}
+
+// Done returns a channel that is closed once the game has exited.
+func (p *GameProcess) Done() <-chan struct{} {
+	return p.done
+}
+
+// Exited reports whether the game has exited.
+func (p *GameProcess) Exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait blocks until the game exits and returns its exit code.
+func (p *GameProcess) Wait() (int, error) {
+	<-p.done
+	return p.exitCode, p.err
+}
+
+// ExitCode returns the exit code of the game, or -1 if it is still running.
+func (p *GameProcess) ExitCode() int {
+	if !p.Exited() {
+		return -1
+	}
+	return p.exitCode
+}
+
+// Kill terminates the game if it is still running.
+func (p *GameProcess) Kill() error {
+	if p.Exited() {
+		return nil
+	}
+	if err := p.cmd.Process.Kill(); err != nil && !p.Exited() {
+		return err
+	}
+	return nil
+}
+
+// RunningGames returns the handles of all game instances that are still running.
+func RunningGames() []*GameProcess {
+	runningGamesMu.Lock()
+	defer runningGamesMu.Unlock()
+
+	var processes []*GameProcess
+	for process := range runningGames {
+		processes = append(processes, process)
+	}
+	return processes
+}
+
+// IsProfileRunning reports whether a game instance using the profile is running.
+// Games started by this process are always found. Games started through Steam or by
+// other processes are detected on a best-effort basis, see profileInUse, so a false
+// result doesn't guarantee that the profile is unused.
+func IsProfileRunning(profile string) bool {
+	for _, process := range RunningGames() {
+		if process.Profile == profile {
+			return true
+		}
+	}
+	return profileInUse(filesystem.ProfilePath(profile))
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+// profileInUse reports whether a running process was started with the profile's
+// Doorstop target, which is how launches through Steam and Proton point the game at it.
+func profileInUse(profilePath string) bool {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil {
+		return false
+	}
+
+	target := []byte(filepath.Join(profilePath, "BepInEx") + string(filepath.Separator))
+	for _, path := range cmdlines {
+		cmdline, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if bytes.Contains(cmdline, []byte("--doorstop-target")) && bytes.Contains(cmdline, target) {
+			return true
+		}
+	}
+	return false
+}
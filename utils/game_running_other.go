@@ -0,0 +1,8 @@
+//go:build !windows && !linux
+
+package utils
+
+// profileInUse can't detect games started by other processes on this platform.
+func profileInUse(profilePath string) bool {
+	return false
+}
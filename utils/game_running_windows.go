@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// profileInUse reports whether a game has the profile's BepInEx log open. BepInEx
+// keeps LogOutput.log open for writing while the game runs and only shares it for
+// reading, so opening it for writing fails with a sharing violation.
+func profileInUse(profilePath string) bool {
+	file, err := os.OpenFile(filepath.Join(profilePath, "BepInEx", "LogOutput.log"), os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Is(err, windows.ERROR_SHARING_VIOLATION)
+	}
+	file.Close()
+	return false
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+	"github.com/The-Lethal-Foundation/lethal-core/filesystem"
+	"github.com/The-Lethal-Foundation/lethal-core/internal/fileutil"
+)
+
+const LaunchSettingsFileName = "launch_settings.json"
+
+// LaunchSettings are the per-profile settings applied when launching the game.
+type LaunchSettings struct {
+	// ExtraArgs are appended to the game's command line, e.g. "-screen-fullscreen 0".
+	ExtraArgs []string `json:"extra_args"`
+	// Environment holds extra environment variables for the game. Steam starts the
+	// game itself with -applaunch and can't pass them on, so they are rejected in
+	// the Steam launch mode.
+	Environment map[string]string `json:"environment"`
+	// PreLaunchCommand is run before the game starts; a non-zero exit aborts the launch.
+	PreLaunchCommand []string `json:"pre_launch_command"`
+	// Vanilla launches the game with Doorstop disabled, so no mods are loaded.
+	Vanilla bool `json:"vanilla"`
+}
+
+// GetLaunchSettings reads the launch settings of the profile.
+// A profile without a settings file gets the default settings.
+func GetLaunchSettings(profile string) (*LaunchSettings, error) {
+	settingsPath := filepath.Join(filesystem.ProfilePath(profile), LaunchSettingsFileName)
+
+	file, err := os.ReadFile(settingsPath)
+	if os.IsNotExist(err) {
+		return &LaunchSettings{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var settings LaunchSettings
+	if err := json.Unmarshal(file, &settings); err != nil {
+		return nil, fmt.Errorf("error unmarshaling launch settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SetLaunchSettings saves the launch settings of the profile.
+// The settings must be valid for the launch mode in the config.
+func SetLaunchSettings(profile string, settings *LaunchSettings) error {
+	profilePath := filesystem.ProfilePath(profile)
+	if _, err := os.Stat(profilePath); err != nil {
+		return err
+	}
+
+	if err := settings.Validate(config.Active().LaunchMode); err != nil {
+		return err
+	}
+
+	settingsFile, err := json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteFile(filepath.Join(profilePath, LaunchSettingsFileName), settingsFile, 0644)
+}
+
+// Validate checks that the settings can be applied in the given launch mode.
+func (settings *LaunchSettings) Validate(launchMode string) error {
+	if len(settings.Environment) > 0 && launchMode == config.LaunchModeSteam {
+		return fmt.Errorf("environment variables can't be passed to the game when launching through Steam, use the %q launch mode", config.LaunchModeDirect)
+	}
+	for key := range settings.Environment {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+	}
+	if len(settings.PreLaunchCommand) > 0 && settings.PreLaunchCommand[0] == "" {
+		return fmt.Errorf("pre-launch command has no executable")
+	}
+	return nil
+}
+
+// runPreLaunchCommand runs the profile's pre-launch check, if it has one.
+func runPreLaunchCommand(profilePath string, settings *LaunchSettings) error {
+	if len(settings.PreLaunchCommand) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command(settings.PreLaunchCommand[0], settings.PreLaunchCommand[1:]...)
+	cmd.Dir = profilePath
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pre-launch check failed: %w", err)
+	}
+
+	return nil
+}
+
+// environmentList converts the settings environment into KEY=value pairs.
+func (settings *LaunchSettings) environmentList() []string {
+	var env []string
+	for key, value := range settings.Environment {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
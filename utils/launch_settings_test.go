@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+)
+
+func TestLaunchSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   LaunchSettings
+		launchMode string
+		valid      bool
+	}{
+		{"empty", LaunchSettings{}, config.LaunchModeSteam, true},
+		{"extra args through Steam", LaunchSettings{ExtraArgs: []string{"-screen-fullscreen", "0"}}, config.LaunchModeSteam, true},
+		{"environment through Steam", LaunchSettings{Environment: map[string]string{"DOORSTOP_DISABLE": "1"}}, config.LaunchModeSteam, false},
+		{"environment launched directly", LaunchSettings{Environment: map[string]string{"DOORSTOP_DISABLE": "1"}}, config.LaunchModeDirect, true},
+		{"empty variable name", LaunchSettings{Environment: map[string]string{"": "1"}}, config.LaunchModeDirect, false},
+		{"variable name with =", LaunchSettings{Environment: map[string]string{"A=B": "1"}}, config.LaunchModeDirect, false},
+		{"pre-launch command", LaunchSettings{PreLaunchCommand: []string{"check.sh", "--strict"}}, config.LaunchModeSteam, true},
+		{"pre-launch command without executable", LaunchSettings{PreLaunchCommand: []string{"", "--strict"}}, config.LaunchModeSteam, false},
+	}
+
+	for _, test := range tests {
+		err := test.settings.Validate(test.launchMode)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: Validate(%q) = %v, want valid %v", test.name, test.launchMode, err, test.valid)
+		}
+	}
+}
+
+func TestSetLaunchSettings(t *testing.T) {
+	profilePath := setupProfile(t, "Main")
+	t.Setenv("LETHAL_CORE_LAUNCH_MODE", config.LaunchModeDirect)
+
+	settings := &LaunchSettings{
+		ExtraArgs:        []string{"-screen-fullscreen", "0"},
+		Environment:      map[string]string{"LETHAL_TEST": "yes"},
+		PreLaunchCommand: []string{"check.sh"},
+		Vanilla:          true,
+	}
+	if err := SetLaunchSettings("Main", settings); err != nil {
+		t.Fatalf("SetLaunchSettings() failed: %v", err)
+	}
+	got, err := GetLaunchSettings("Main")
+	if err != nil {
+		t.Fatalf("GetLaunchSettings() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, settings) {
+		t.Errorf("GetLaunchSettings() = %+v, want %+v", got, settings)
+	}
+
+	// The saved environment can't be applied once the game is launched through Steam.
+	t.Setenv("LETHAL_CORE_LAUNCH_MODE", config.LaunchModeSteam)
+	if err := SetLaunchSettings("Main", settings); err == nil {
+		t.Error("SetLaunchSettings() saved an environment for Steam launches")
+	}
+	if _, _, err := prepareLaunch(profilePath, "Main", config.LaunchModeSteam); err == nil {
+		t.Error("prepareLaunch() launched through Steam with an environment")
+	}
+}
+
+func TestGetLaunchSettingsDefaults(t *testing.T) {
+	profilePath := setupProfile(t, "Main")
+
+	settings, err := GetLaunchSettings("Main")
+	if err != nil {
+		t.Fatalf("GetLaunchSettings() failed: %v", err)
+	}
+	if !reflect.DeepEqual(settings, &LaunchSettings{}) {
+		t.Errorf("GetLaunchSettings() = %+v, want the defaults", settings)
+	}
+
+	if err := os.WriteFile(filepath.Join(profilePath, LaunchSettingsFileName), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetLaunchSettings("Main"); err == nil {
+		t.Error("GetLaunchSettings() accepted an invalid settings file")
+	}
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/The-Lethal-Foundation/lethal-core/config"
+)
+
+const GameDirName = "Lethal Company"
+const GameExecutableName = "Lethal Company.exe"
+
+// defaultSteamDir is where the Steam installer puts Steam on windows.
+const defaultSteamDir = `C:\Program Files (x86)\Steam`
+
+// ErrGameNotFound is returned when the game install directory could not be discovered.
+var ErrGameNotFound = errors.New("could not find the Lethal Company install directory")
+
+// libraryPathPattern matches the "path" entries of Steam's libraryfolders.vdf.
+var libraryPathPattern = regexp.MustCompile(`"path"\s+"([^"]+)"`)
+
+// FindGameInstallDir returns the game directory set in the config, or looks through
+// the Steam library folders for the directory containing the game executable.
+func FindGameInstallDir() (string, error) {
+	if gameDir := config.Active().GamePath; gameDir != "" {
+		if _, err := os.Stat(filepath.Join(gameDir, GameExecutableName)); err != nil {
+			return "", fmt.Errorf("%w: no %s in the configured game path %s", ErrGameNotFound, GameExecutableName, gameDir)
+		}
+		return gameDir, nil
+	}
+
+	for _, library := range steamLibraryFolders() {
+		gameDir := filepath.Join(library, "steamapps", "common", GameDirName)
+		if _, err := os.Stat(filepath.Join(gameDir, GameExecutableName)); err == nil {
+			return gameDir, nil
+		}
+	}
+
+	return "", ErrGameNotFound
+}
+
+// steamExecutable returns the Steam executable, from the Steam directory in the
+// config or the usual install location.
+func steamExecutable() string {
+	steamDir := config.Active().SteamPath
+	if runtime.GOOS == "windows" {
+		if steamDir == "" {
+			steamDir = defaultSteamDir
+		}
+		return filepath.Join(steamDir, "steam.exe")
+	}
+
+	if steamDir == "" {
+		return "steam"
+	}
+	return filepath.Join(steamDir, "steam.sh")
+}
+
+// steamRootDirs returns the Steam directory set in the config, or the directories
+// Steam is usually installed in.
+func steamRootDirs() []string {
+	if steamDir := config.Active().SteamPath; steamDir != "" {
+		return []string{steamDir}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{defaultSteamDir}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".steam", "steam"),
+		filepath.Join(home, ".local", "share", "Steam"),
+	}
+}
+
+// steamLibraryFolders returns every Steam library folder listed in libraryfolders.vdf,
+// including the Steam root directories themselves.
+func steamLibraryFolders() []string {
+	var libraries []string
+	for _, root := range steamRootDirs() {
+		libraries = append(libraries, root)
+
+		vdf, err := os.ReadFile(filepath.Join(root, "steamapps", "libraryfolders.vdf"))
+		if err != nil {
+			continue
+		}
+
+		for _, match := range libraryPathPattern.FindAllStringSubmatch(string(vdf), -1) {
+			libraries = append(libraries, filepath.FromSlash(strings.ReplaceAll(match[1], `\\`, `\`)))
+		}
+	}
+
+	return libraries
+}
@@ -14,6 +14,9 @@ import (
 
 // CloneOtherProfiles accepts a map of mod manager names to their profiles directory paths.
 // It copies all profiles for each specified mod manager to a new location.
+//
+// Deprecated: CloneOtherProfiles only finds the managers on Windows and copies the
+// profiles without reading their mods. Use profile.ImportProfiles instead.
 func CloneOtherProfiles(modManagers map[string]string) error {
 	for managerName, relativeProfilesPath := range modManagers {
 		globalProfilesPath := filepath.Join(os.Getenv("APPDATA"), relativeProfilesPath)
@@ -31,7 +34,7 @@ func CloneOtherProfiles(modManagers map[string]string) error {
 
 			// Create the new profile path in the manager's directory
 			profileName := managerName + "-" + profile.Name()
-			newProfilePath := filepath.Join(filesystem.GetDefaultPath(), "LethalCompany", "Profiles", profileName)
+			newProfilePath := filesystem.ProfilePath(profileName)
 			err := os.MkdirAll(newProfilePath, os.ModePerm)
 			if err != nil {
 				return err